@@ -0,0 +1,212 @@
+// Package apperr defines the domain errors services return and handlers map
+// to HTTP responses (see handler.Handler.Error). Messages of these errors are
+// meant for clients; wrapped causes are only logged.
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+type NotFoundError struct {
+	Resource string
+	ID       any
+	Err      error
+}
+
+func NotFound(resource string, id any) *NotFoundError {
+	return &NotFoundError{Resource: resource, ID: id}
+}
+
+func (e *NotFoundError) Error() string {
+	switch {
+	case e.Resource == "":
+		return "not found"
+	case e.ID == nil:
+		return e.Resource + " not found"
+	default:
+		return fmt.Sprintf("%s %v not found", e.Resource, e.ID)
+	}
+}
+
+func (e *NotFoundError) Unwrap() error { return e.Err }
+
+type ConflictError struct {
+	Message string
+	Err     error
+}
+
+func Conflict(message string) *ConflictError {
+	return &ConflictError{Message: message}
+}
+
+func (e *ConflictError) Error() string {
+	if e.Message == "" {
+		return "conflict"
+	}
+	return e.Message
+}
+
+func (e *ConflictError) Unwrap() error { return e.Err }
+
+// ValidationError wraps the validator.ValidationErrors (or any error) that
+// made the input invalid. Target, the validated value, lets messages use the
+// fields' `label` tags.
+type ValidationError struct {
+	Message string
+	Target  any
+	Err     error
+}
+
+func Validation(err error) *ValidationError {
+	return &ValidationError{Err: err}
+}
+
+func (e *ValidationError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return "validation failed"
+}
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+type UnauthorizedError struct {
+	Message string
+	// Scheme, when set, is announced in WWW-Authenticate (e.g. "Basic").
+	Scheme string
+	Realm  string
+	Err    error
+}
+
+func Unauthorized(message string) *UnauthorizedError {
+	return &UnauthorizedError{Message: message}
+}
+
+func (e *UnauthorizedError) Error() string {
+	if e.Message == "" {
+		return "unauthorized"
+	}
+	return e.Message
+}
+
+func (e *UnauthorizedError) Unwrap() error { return e.Err }
+
+// Challenge returns the WWW-Authenticate header value, if any.
+func (e *UnauthorizedError) Challenge() string {
+	if e.Scheme == "" {
+		return ""
+	}
+	realm := e.Realm
+	if realm == "" {
+		realm = "restricted"
+	}
+	return fmt.Sprintf(`%s realm="%s", charset="UTF-8"`, e.Scheme, realm)
+}
+
+type ForbiddenError struct {
+	Message string
+	Err     error
+}
+
+func Forbidden(message string) *ForbiddenError {
+	return &ForbiddenError{Message: message}
+}
+
+func (e *ForbiddenError) Error() string {
+	if e.Message == "" {
+		return "forbidden"
+	}
+	return e.Message
+}
+
+func (e *ForbiddenError) Unwrap() error { return e.Err }
+
+type RateLimitedError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func RateLimited(retryAfter time.Duration) *RateLimitedError {
+	return &RateLimitedError{RetryAfter: retryAfter}
+}
+
+func (e *RateLimitedError) Error() string {
+	return "rate limit exceeded"
+}
+
+func (e *RateLimitedError) Unwrap() error { return e.Err }
+
+// RetryAfterSeconds rounds RetryAfter up to whole seconds, as sent in the
+// Retry-After header.
+func (e *RateLimitedError) RetryAfterSeconds() int {
+	s := int((e.RetryAfter + time.Second - 1) / time.Second)
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+// InternalError marks an unexpected failure. It records the stack where it
+// was created so logs point at the origin, not at the handler.
+type InternalError struct {
+	Message string
+	Err     error
+	stack   []uintptr
+}
+
+// Internal wraps err with the caller's stack.
+func Internal(err error) *InternalError {
+	return &InternalError{Err: err, stack: callers()}
+}
+
+// Wrap annotates err with a message and the caller's stack.
+func Wrap(err error, message string) *InternalError {
+	return &InternalError{Message: message, Err: err, stack: callers()}
+}
+
+func (e *InternalError) Error() string {
+	switch {
+	case e.Err == nil:
+		return e.Message
+	case e.Message == "":
+		return e.Err.Error()
+	default:
+		return e.Message + ": " + e.Err.Error()
+	}
+}
+
+func (e *InternalError) Unwrap() error { return e.Err }
+
+// StackTrace formats the stack captured at creation.
+func (e *InternalError) StackTrace() string {
+	var sb strings.Builder
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
+
+func callers() []uintptr {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	return pcs[:n]
+}
+
+// StackTrace returns the stack recorded by the first InternalError in err's
+// chain, or "" when there is none.
+func StackTrace(err error) string {
+	var ie *InternalError
+	if errors.As(err, &ie) {
+		return ie.StackTrace()
+	}
+	return ""
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Policy decides whether a principal holds a permission ("posts.edit"),
+// optionally on a resource; resource is nil for checks made before any
+// resource is loaded (routes, grid actions).
+type Policy interface {
+	Can(ctx context.Context, p *Principal, permission string, resource any) bool
+}
+
+// PolicyFunc adapts a function to Policy.
+type PolicyFunc func(ctx context.Context, p *Principal, permission string, resource any) bool
+
+func (f PolicyFunc) Can(ctx context.Context, p *Principal, permission string, resource any) bool {
+	return f(ctx, p, permission, resource)
+}
+
+// Predicate is an attribute-based condition on the principal and resource.
+type Predicate func(ctx context.Context, p *Principal, resource any) bool
+
+// RBAC grants permissions to roles, narrowed by the principal's scopes, with
+// attribute-based predicates on top:
+//
+//	policy := auth.NewRBAC().
+//		Grant("admin", "*").
+//		Grant("editor", "posts.*").
+//		Allow("posts.edit", isAuthor).      // authors edit their own posts
+//		Require("posts.delete", isDraft)    // even admins only delete drafts
+//
+// Permissions ending in ".*" grant every permission under the prefix and "*"
+// grants all of them. A permission is held when granted (by a role or an
+// Allow predicate), covered by one of the scopes when the principal has
+// scopes (a token only narrows what its user may do), and every Require
+// predicate holds.
+//
+// Predicates are about a resource: checks without one (routes, grid
+// actions) skip them, so they never see a nil resource. Such checks grant by
+// role only and leave the conditions to the check made once the resource is
+// loaded.
+type RBAC struct {
+	mu      sync.RWMutex
+	roles   map[string][]string
+	allow   map[string][]Predicate
+	require map[string][]Predicate
+}
+
+func NewRBAC() *RBAC {
+	return &RBAC{
+		roles:   make(map[string][]string),
+		allow:   make(map[string][]Predicate),
+		require: make(map[string][]Predicate),
+	}
+}
+
+// Grant gives permissions to role.
+func (r *RBAC) Grant(role string, permissions ...string) *RBAC {
+	r.mu.Lock()
+	r.roles[role] = append(r.roles[role], permissions...)
+	r.mu.Unlock()
+	return r
+}
+
+// Allow grants permission to any principal for which pred holds.
+func (r *RBAC) Allow(permission string, pred Predicate) *RBAC {
+	r.mu.Lock()
+	r.allow[permission] = append(r.allow[permission], pred)
+	r.mu.Unlock()
+	return r
+}
+
+// Require adds a condition to permission, whoever it is granted to.
+func (r *RBAC) Require(permission string, pred Predicate) *RBAC {
+	r.mu.Lock()
+	r.require[permission] = append(r.require[permission], pred)
+	r.mu.Unlock()
+	return r
+}
+
+// Permissions returns the permissions granted to role.
+func (r *RBAC) Permissions(role string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.roles[role]...)
+}
+
+func (r *RBAC) Can(ctx context.Context, p *Principal, permission string, resource any) bool {
+	if p == nil || permission == "" {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(p.Scopes) > 0 && !slices.ContainsFunc(p.Scopes, func(scope string) bool { return Match(scope, permission) }) {
+		return false
+	}
+	if resource != nil {
+		for _, pred := range r.require[permission] {
+			if !pred(ctx, p, resource) {
+				return false
+			}
+		}
+	}
+
+	for _, role := range p.Roles {
+		for _, granted := range r.roles[role] {
+			if Match(granted, permission) {
+				return true
+			}
+		}
+	}
+	if resource != nil {
+		for _, pred := range r.allow[permission] {
+			if pred(ctx, p, resource) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Match reports whether granted covers permission: equal, "*", or a
+// "prefix.*" wildcard.
+func Match(granted, permission string) bool {
+	if granted == permission || granted == "*" {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(granted, "*")
+	return ok && strings.HasSuffix(prefix, ".") && strings.HasPrefix(permission, prefix)
+}
+
+// Can checks permission for the principal of ctx.
+func Can(ctx context.Context, policy Policy, permission string, resource any) bool {
+	return policy.Can(ctx, FromContext(ctx), permission, resource)
+}
+
+// Checker returns a permission check for the principal of ctx, without
+// resource, as used to filter grid actions.
+func Checker(ctx context.Context, policy Policy) func(permission string) bool {
+	p := FromContext(ctx)
+	return func(permission string) bool {
+		return policy.Can(ctx, p, permission, nil)
+	}
+}
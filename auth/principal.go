@@ -0,0 +1,72 @@
+// Package auth defines the principal authenticated for a request (see the
+// authenticators of http/middleware) and how it travels in the context.
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+// Authentication methods recorded in Principal.Method.
+const (
+	MethodSession = "session"
+	MethodBasic   = "basic"
+	MethodJWT     = "jwt"
+	MethodAPIKey  = "apikey"
+)
+
+// Principal is the authenticated identity of a request.
+type Principal struct {
+	ID     string
+	Name   string
+	Method string
+	Roles  []string
+	// Scopes restrict the credentials (token scopes, API key permissions)
+	// to a subset of what Roles grant; none means no restriction.
+	Scopes []string
+	Claims map[string]any
+	// User is the application's user, when the authenticator loads it.
+	User any
+}
+
+// HasRole reports whether p has one of roles.
+func (p *Principal) HasRole(roles ...string) bool {
+	if p == nil {
+		return false
+	}
+	for _, role := range roles {
+		if slices.Contains(p.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether p was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && slices.Contains(p.Scopes, scope)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of ctx, or nil for anonymous requests.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// User returns the application user of the principal of ctx as a T.
+func User[T any](ctx context.Context) (T, bool) {
+	var zero T
+	p := FromContext(ctx)
+	if p == nil {
+		return zero, false
+	}
+	u, ok := p.User.(T)
+	return u, ok
+}
@@ -1,6 +1,8 @@
 package boostrap
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -8,11 +10,23 @@ import (
 	"syscall"
 
 	"github.com/socle-lab/core"
+	"github.com/socle-lab/pkg/http/middleware"
+	"github.com/socle-lab/pkg/logging"
+	"github.com/socle-lab/pkg/metrics"
 )
 
 type Application struct {
 	Core *core.Core
-	wg   sync.WaitGroup
+	// CORS configures the CORS middleware of the entrypoints mounted by
+	// MountRoutes, by entrypoint name; entrypoints without entry get none.
+	CORS map[string]middleware.CORSOptions
+	// Logger receives the logs of the application (see the logging
+	// package). Defaults to the info and error loggers of Core.
+	Logger *slog.Logger
+	// Metrics, when set, records the HTTP metrics of the routes mounted by
+	// MountRoutes (see middleware.Metrics); MountMetrics exposes it.
+	Metrics *metrics.Registry
+	wg      sync.WaitGroup
 }
 
 func (a *Application) shutdown() {
@@ -24,7 +38,7 @@ func (app *Application) ListenForShutdown() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	s := <-quit
 
-	app.Core.Log.InfoLog.Println("Received signal", s.String())
+	app.Slog().Info("received signal", "signal", s.String())
 	app.shutdown()
 
 	os.Exit(0)
@@ -35,16 +49,39 @@ func (a *Application) ListenAndServe(entrypoint string) error {
 }
 
 func (a *Application) MountRoutes(entrypoint string, routes http.Handler) {
+	m := &middleware.Middleware{Core: a.Core}
+	if opts, ok := a.CORS[entrypoint]; ok {
+		// Wrapping the routes, not Use, so preflights reach CORS even for
+		// routes without an OPTIONS handler.
+		routes = m.CORS(opts)(routes)
+	}
+	if a.Metrics != nil {
+		routes = m.Metrics(a.Metrics)(routes)
+	}
 	a.Core.Entrypoints[entrypoint].Routes.Mount("/", routes)
 }
 
-func (a *Application) Log(tag string, args ...any) {
-	switch tag {
-	case "info":
-		a.Core.Log.InfoLog.Println(args...)
-	case "error":
-		a.Core.Log.ErrorLog.Println(args...)
-	default:
-		a.Core.Log.InfoLog.Println(args...)
+// MountMetrics serves Metrics (metrics.Default when unset) in the
+// Prometheus text format on /metrics of entrypoint. Prefer an internal
+// entrypoint, or protect the route: metrics reveal the routes and load.
+func (a *Application) MountMetrics(entrypoint string) {
+	reg := a.Metrics
+	if reg == nil {
+		reg = metrics.Default
 	}
+	a.Core.Entrypoints[entrypoint].Routes.Method(http.MethodGet, "/metrics", reg.Handler())
+}
+
+// Slog returns Logger, or an adapter of the info and error loggers of Core.
+func (a *Application) Slog() *slog.Logger {
+	if a.Logger != nil {
+		return a.Logger
+	}
+	return logging.Std(a.Core.Log.InfoLog, a.Core.Log.ErrorLog)
+}
+
+// Log logs args to the error log for the "error" tag, to the info log for
+// any other.
+func (a *Application) Log(tag string, args ...any) {
+	logging.Log(context.Background(), a.Slog(), tag, slog.LevelInfo, args...)
 }
@@ -0,0 +1,262 @@
+package csv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts are tried in order when a column is bound to a time.Time field
+// without an explicit `layout` tag.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"02/01/2006",
+}
+
+// FieldError reports a value that could not be converted into its struct field.
+type FieldError struct {
+	Line   int
+	Column string
+	Value  string
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("line %d: column %q: cannot convert %q: %v", e.Line, e.Column, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// column binds a CSV header column to a struct field.
+type column struct {
+	index  int    // position in the CSV record
+	field  int    // struct field index
+	name   string // CSV header name
+	db     string // database column name (db tag, falls back to the csv tag)
+	layout string // optional time layout
+}
+
+// Decoder reads tabular records into structs of type T, mapping header
+// columns to fields through their `csv` tag (case-insensitive).
+type Decoder[T any] struct {
+	reader  RecordReader
+	typ     reflect.Type
+	columns []column
+	width   int  // header length the columns were mapped from
+	serial  bool // numbers are accepted as spreadsheet date serials
+}
+
+// NewDecoder reads the CSV header line from r and prepares the column mapping.
+func NewDecoder[T any](r io.Reader) (*Decoder[T], error) {
+	rr, err := CSV.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecordDecoder[T](rr)
+}
+
+// NewFormatDecoder decodes r with the given format.
+func NewFormatDecoder[T any](r io.Reader, format Format) (*Decoder[T], error) {
+	rr, err := format.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecordDecoder[T](rr)
+}
+
+// NewRecordDecoder decodes the records of an already opened reader.
+func NewRecordDecoder[T any](rr RecordReader) (*Decoder[T], error) {
+	var model T
+	t := reflect.TypeOf(model)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.New("generic type must be a struct")
+	}
+
+	header := rr.Header()
+	_, serial := rr.(*xlsxReader)
+	return &Decoder[T]{
+		reader:  rr,
+		typ:     t,
+		columns: mapColumns(t, header),
+		width:   len(header),
+		serial:  serial,
+	}, nil
+}
+
+func mapColumns(t reflect.Type, header []string) []column {
+	var columns []column
+	for i, col := range header {
+		csvCol := strings.TrimSpace(strings.ToLower(col))
+		for j := 0; j < t.NumField(); j++ {
+			field := t.Field(j)
+			tag := field.Tag.Get("csv")
+			if tag == "" || tag == "-" || strings.ToLower(tag) != csvCol {
+				continue
+			}
+
+			db := field.Tag.Get("db")
+			if db == "" {
+				db = tag
+			}
+			columns = append(columns, column{
+				index:  i,
+				field:  j,
+				name:   tag,
+				db:     db,
+				layout: field.Tag.Get("layout"),
+			})
+			break
+		}
+	}
+	return columns
+}
+
+// Line returns the line (or sheet row) of the last record read; the header
+// is line 1.
+func (d *Decoder[T]) Line() int {
+	return d.reader.Line()
+}
+
+// Skip reads and discards the next n records without decoding them.
+func (d *Decoder[T]) Skip(n int64) error {
+	for i := int64(0); i < n; i++ {
+		if _, err := d.reader.Read(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("error skipping row: %w", err)
+		}
+	}
+	return nil
+}
+
+// Decode reads the next record. It returns io.EOF when the input is exhausted
+// and a *FieldError when a value cannot be converted; in that case the
+// decoder can keep reading the following records.
+func (d *Decoder[T]) Decode() (T, error) {
+	var out T
+
+	row, err := d.reader.Read()
+	if err == io.EOF {
+		return out, io.EOF
+	}
+	if err != nil {
+		return out, fmt.Errorf("error reading row: %w", err)
+	}
+
+	// Formats without a fixed header discover new columns while reading.
+	if header := d.reader.Header(); len(header) != d.width {
+		d.columns = mapColumns(d.typ, header)
+		d.width = len(header)
+	}
+
+	val := reflect.New(d.typ).Elem()
+	for _, c := range d.columns {
+		if c.index >= len(row) {
+			continue
+		}
+		if err := setField(val.Field(c.field), row[c.index], c.layout, d.serial); err != nil {
+			return out, &FieldError{Line: d.Line(), Column: c.name, Value: row[c.index], Err: err}
+		}
+	}
+
+	return val.Interface().(T), nil
+}
+
+// setField converts a raw CSV value into the field kind. Empty values leave
+// the field at its zero value (nil for pointers). With serial, times may also
+// be spreadsheet date serials.
+func setField(f reflect.Value, raw, layout string, serial bool) error {
+	if !f.CanSet() {
+		return nil
+	}
+	if f.Kind() == reflect.String {
+		f.SetString(raw)
+		return nil
+	}
+
+	value := strings.TrimSpace(raw)
+	if value == "" {
+		return nil
+	}
+
+	if f.Kind() == reflect.Ptr {
+		p := reflect.New(f.Type().Elem())
+		if err := setField(p.Elem(), value, layout, serial); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+
+	if f.Type() == reflect.TypeOf(time.Time{}) {
+		t, err := parseTime(value, layout, serial)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+
+	case reflect.Bool:
+		switch strings.ToLower(value) {
+		case "1", "true", "yes", "on", "oui":
+			f.SetBool(true)
+		case "0", "false", "no", "off", "non":
+			f.SetBool(false)
+		default:
+			return fmt.Errorf("invalid boolean")
+		}
+
+	default:
+		return fmt.Errorf("unsupported field kind %s", f.Kind())
+	}
+
+	return nil
+}
+
+func parseTime(value, layout string, serial bool) (time.Time, error) {
+	if layout != "" {
+		return time.Parse(layout, value)
+	}
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l, value); err == nil {
+			return t, nil
+		}
+	}
+	// Spreadsheets store dates as day serials.
+	if serial {
+		if days, err := strconv.ParseFloat(value, 64); err == nil && days > 0 {
+			return excelSerialToTime(days), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date format")
+}
@@ -0,0 +1,183 @@
+package csv
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"time"
+)
+
+// structHeader returns the `csv` tags of t in field order.
+func structHeader(t reflect.Type) []string {
+	var header []string
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("csv")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		header = append(header, tag)
+	}
+	return header
+}
+
+// Encoder writes structs of type T as tabular records. The header is made of
+// the `csv` tags in field order; time.Time fields honor the `layout` tag.
+type Encoder[T any] struct {
+	writer  RecordWriter
+	columns []column
+	started bool
+}
+
+// NewEncoder writes to w with the given format. Close must be called to flush
+// the output.
+func NewEncoder[T any](w io.Writer, format Format) (*Encoder[T], error) {
+	var model T
+	t := reflect.TypeOf(model)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.New("generic type must be a struct")
+	}
+
+	return &Encoder[T]{
+		writer:  format.NewWriter(w),
+		columns: mapColumns(t, structHeader(t)),
+	}, nil
+}
+
+func (e *Encoder[T]) writeHeader() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+
+	header := make([]string, len(e.columns))
+	for i, c := range e.columns {
+		header[i] = c.name
+	}
+	return e.writer.WriteHeader(header)
+}
+
+// Encode writes one record, preceded by the header on the first call.
+func (e *Encoder[T]) Encode(row T) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(row)
+	values := make([]any, len(e.columns))
+	for i, c := range e.columns {
+		values[i] = exportValue(v.Field(c.field), c.layout)
+	}
+	return e.writer.Write(values)
+}
+
+// Close writes the header if no record was encoded and flushes the output.
+func (e *Encoder[T]) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.writer.Close()
+}
+
+// exportValue unwraps pointers and formats times; other values are passed
+// as is so typed formats keep numbers and booleans.
+func exportValue(f reflect.Value, layout string) any {
+	for f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			return nil
+		}
+		f = f.Elem()
+	}
+	if !f.CanInterface() {
+		return nil
+	}
+
+	if t, ok := f.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return nil
+		}
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		return t.Format(layout)
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		return f.String()
+	case reflect.Bool:
+		return f.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return f.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return f.Uint()
+	case reflect.Float32, reflect.Float64:
+		return f.Float()
+	default:
+		return f.Interface()
+	}
+}
+
+// Export writes rows to w with the given format.
+func Export[T any](w io.Writer, format Format, rows []T) error {
+	enc, err := NewEncoder[T](w, format)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// ExportCSV writes rows to w as CSV.
+func ExportCSV[T any](w io.Writer, rows []T) error {
+	return Export(w, CSV, rows)
+}
+
+// ExportSlice writes rows, a slice of structs or of pointers to structs, to
+// w with the given format. It is the untyped counterpart of Export for
+// callers that only hold an any.
+func ExportSlice(w io.Writer, format Format, rows any) error {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return errors.New("rows must be a slice of structs")
+	}
+	t := v.Type().Elem()
+	ptr := t.Kind() == reflect.Ptr
+	if ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return errors.New("rows must be a slice of structs")
+	}
+
+	columns := mapColumns(t, structHeader(t))
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.name
+	}
+
+	writer := format.NewWriter(w)
+	if err := writer.WriteHeader(header); err != nil {
+		return err
+	}
+	for i := 0; i < v.Len(); i++ {
+		row := v.Index(i)
+		if ptr {
+			if row.IsNil() {
+				continue
+			}
+			row = row.Elem()
+		}
+		values := make([]any, len(columns))
+		for j, c := range columns {
+			values[j] = exportValue(row.Field(c.field), c.layout)
+		}
+		if err := writer.Write(values); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
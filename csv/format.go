@@ -0,0 +1,213 @@
+package csv
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecordReader reads tabular records column by column. Header returns the
+// column names; it may grow while reading for formats without a fixed header
+// (JSON Lines), values are always aligned on the current header.
+type RecordReader interface {
+	Header() []string
+	Read() ([]string, error)
+	Line() int
+}
+
+// dynamicHeader is implemented by readers whose header grows while reading
+// (JSON Lines): keys first seen after the first record are still columns.
+type dynamicHeader interface {
+	dynamicHeader()
+}
+
+// RecordWriter writes tabular records. Values are native Go values (string,
+// numbers, bool or nil) so typed formats can keep them typed.
+type RecordWriter interface {
+	WriteHeader(header []string) error
+	Write(values []any) error
+	Close() error
+}
+
+// Format is a tabular file format.
+type Format interface {
+	Name() string
+	ContentType() string
+	Extension() string
+	NewReader(r io.Reader) (RecordReader, error)
+	NewWriter(w io.Writer) RecordWriter
+}
+
+var (
+	CSV       Format = csvFormat{comma: ','}
+	XLSX      Format = XLSXFormat{}
+	JSONLines Format = jsonLinesFormat{}
+)
+
+// Formats lists the supported formats, in order of preference.
+var Formats = []Format{CSV, XLSX, JSONLines}
+
+var contentTypeAliases = map[string]Format{
+	"text/csv":                 CSV,
+	"application/csv":          CSV,
+	"application/vnd.ms-excel": CSV, // what browsers often send for .csv
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": XLSX,
+	"application/x-ndjson":    JSONLines,
+	"application/ndjson":      JSONLines,
+	"application/jsonl":       JSONLines,
+	"application/x-jsonlines": JSONLines,
+}
+
+var extensionAliases = map[string]Format{
+	".csv":    CSV,
+	".xlsx":   XLSX,
+	".jsonl":  JSONLines,
+	".ndjson": JSONLines,
+}
+
+// FormatByName returns the format named "csv", "xlsx" or "jsonl".
+func FormatByName(name string) (Format, error) {
+	for _, f := range Formats {
+		if strings.EqualFold(f.Name(), name) {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported format: %s", name)
+}
+
+// FormatByContentType resolves a MIME type, parameters are ignored.
+func FormatByContentType(contentType string) (Format, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported content type: %s", contentType)
+	}
+	if f, ok := contentTypeAliases[mediaType]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unsupported content type: %s", mediaType)
+}
+
+// FormatByExtension resolves a file name or extension.
+func FormatByExtension(name string) (Format, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		ext = "." + strings.ToLower(strings.TrimPrefix(name, "."))
+	}
+	if f, ok := extensionAliases[ext]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unsupported file extension: %s", ext)
+}
+
+// DetectFormat picks the format from the file extension, falling back to the
+// content type (browsers are unreliable with spreadsheet MIME types).
+func DetectFormat(filename, contentType string) (Format, error) {
+	if filename != "" {
+		if f, err := FormatByExtension(filename); err == nil {
+			return f, nil
+		}
+	}
+	if contentType != "" {
+		return FormatByContentType(contentType)
+	}
+	return nil, fmt.Errorf("cannot detect format of %q", filename)
+}
+
+//
+// CSV
+//
+
+type csvFormat struct {
+	comma rune
+}
+
+func (csvFormat) Name() string        { return "csv" }
+func (csvFormat) ContentType() string { return "text/csv; charset=utf-8" }
+func (csvFormat) Extension() string   { return ".csv" }
+
+func (f csvFormat) NewReader(r io.Reader) (RecordReader, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = f.comma
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read header: %w", err)
+	}
+	return &csvReader{reader: reader, header: header, line: 1}, nil
+}
+
+func (f csvFormat) NewWriter(w io.Writer) RecordWriter {
+	writer := csv.NewWriter(w)
+	writer.Comma = f.comma
+	return &csvWriter{writer: writer}
+}
+
+// CSVWithComma returns the CSV format using another separator (e.g. ';').
+func CSVWithComma(comma rune) Format {
+	return csvFormat{comma: comma}
+}
+
+type csvReader struct {
+	reader *csv.Reader
+	header []string
+	line   int
+}
+
+func (r *csvReader) Header() []string { return r.header }
+func (r *csvReader) Line() int        { return r.line }
+
+func (r *csvReader) Read() ([]string, error) {
+	row, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	r.line, _ = r.reader.FieldPos(0)
+	return row, nil
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvWriter) WriteHeader(header []string) error {
+	return w.writer.Write(header)
+}
+
+func (w *csvWriter) Write(values []any) error {
+	row := make([]string, len(values))
+	for i, v := range values {
+		row[i] = formatValue(v)
+	}
+	return w.writer.Write(row)
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// formatValue renders a native value as text.
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -1,13 +1,9 @@
 package csv
 
 import (
-	"encoding/csv"
-	"errors"
 	"fmt"
 	"io"
 	"os"
-	"reflect"
-	"strings"
 )
 
 func ImportCSV[T any](filePath string) ([]T, error) {
@@ -17,54 +13,44 @@ func ImportCSV[T any](filePath string) ([]T, error) {
 	}
 	defer f.Close()
 
-	reader := csv.NewReader(f)
-	reader.TrimLeadingSpace = true
+	return Import[T](f, CSV)
+}
 
-	// Read header
-	header, err := reader.Read()
+// ImportFile reads a CSV, XLSX or JSON Lines file, chosen by its extension.
+func ImportFile[T any](filePath string) ([]T, error) {
+	format, err := FormatByExtension(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("cannot read header: %w", err)
+		return nil, err
 	}
 
-	// Build CSV tag → field index mapping
-	var model T
-	t := reflect.TypeOf(model)
-	if t.Kind() != reflect.Struct {
-		return nil, errors.New("generic type must be a struct")
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file: %w", err)
 	}
+	defer f.Close()
 
-	tagMap := map[int]int{} // csvIndex → structFieldIndex
-	for i, col := range header {
-		csvCol := strings.TrimSpace(strings.ToLower(col))
-		for j := 0; j < t.NumField(); j++ {
-			tag := t.Field(j).Tag.Get("csv")
-			if strings.ToLower(tag) == csvCol {
-				tagMap[i] = j
-				break
-			}
-		}
+	return Import[T](f, format)
+}
+
+// Import reads every record of r with the given format.
+func Import[T any](r io.Reader, format Format) ([]T, error) {
+	dec, err := NewFormatDecoder[T](r, format)
+	if err != nil {
+		return nil, err
 	}
 
 	var results []T
 	// Process rows
 	for {
-		row, err := reader.Read()
+		row, err := dec.Decode()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("error reading row: %w", err)
-		}
-
-		val := reflect.New(t).Elem()
-		for colIndex, fieldIndex := range tagMap {
-			if colIndex >= len(row) {
-				continue
-			}
-			val.Field(fieldIndex).SetString(row[colIndex])
+			return nil, err
 		}
 
-		results = append(results, val.Interface().(T))
+		results = append(results, row)
 	}
 
 	return results, nil
@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusFailed    Status = "failed"
+	StatusCompleted Status = "completed"
+)
+
+var ErrNotFound = errors.New("import job not found")
+
+var (
+	// ErrUnknownImporter is returned by Submit for an importer that was
+	// never registered.
+	ErrUnknownImporter = errors.New("unknown importer")
+	// ErrUnsupportedFormat is returned by Submit when the format of the
+	// upload can't be detected from its file name or content type.
+	ErrUnsupportedFormat = errors.New("unsupported upload format")
+)
+
+// Job tracks one background import. Counters and Checkpoint are saved after
+// every committed batch so an interrupted job resumes where it stopped.
+type Job struct {
+	ID       string `json:"id"`
+	Importer string `json:"importer"`
+	FileName string `json:"file_name"`
+	Format   string `json:"format"`
+	// Upload is the storage name of the uploaded file.
+	Upload string `json:"-"`
+
+	Status     Status `json:"status"`
+	Processed  int64  `json:"processed"`
+	Written    int64  `json:"written"`
+	Failed     int64  `json:"failed"`
+	Checkpoint int64  `json:"checkpoint"`
+	Attempts   int    `json:"attempts"`
+
+	// ErrorReport is the storage name of the CSV listing rejected rows.
+	ErrorReport string `json:"error_report,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Done reports whether the job reached a final status.
+func (j *Job) Done() bool {
+	return j.Status == StatusCompleted || j.Status == StatusFailed
+}
+
+// Store persists jobs. Implementations must make Claim atomic so several
+// workers (or instances) never run the same job.
+type Store interface {
+	Create(ctx context.Context, job *Job) error
+	Get(ctx context.Context, id string) (*Job, error)
+	Update(ctx context.Context, job *Job) error
+	List(ctx context.Context, limit int) ([]*Job, error)
+	// Claim marks the oldest queued job as running and returns it, or nil
+	// when the queue is empty.
+	Claim(ctx context.Context) (*Job, error)
+	// Requeue puts back in the queue the running jobs not updated since
+	// before the given time: their worker died (restart, crash).
+	Requeue(ctx context.Context, staleBefore time.Time) (int, error)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,436 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	stdcsv "encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/socle-lab/pkg/csv"
+)
+
+// Run describes one execution of a job. Importers must pass Format, Skip,
+// Rejected and the callbacks through to csv.ImportToDB (or honor them
+// equivalently) for progress tracking and resumption to work.
+type Run struct {
+	Job    Job
+	Format csv.Format
+	Skip   int64
+	// Rejected is the number of rows rejected by the previous runs.
+	Rejected   int64
+	OnProgress func(csv.Progress)
+	OnRowError func(csv.RowError)
+}
+
+type Importer interface {
+	Import(ctx context.Context, r io.Reader, run Run) (csv.ImportResult, error)
+}
+
+type ImporterFunc func(ctx context.Context, r io.Reader, run Run) (csv.ImportResult, error)
+
+func (f ImporterFunc) Import(ctx context.Context, r io.Reader, run Run) (csv.ImportResult, error) {
+	return f(ctx, r, run)
+}
+
+// TableImporter imports rows of type T with csv.ImportToDB. Batches are
+// always committed one by one so checkpoints are durable, and by a single
+// worker unless the import is an upsert, so a resumed job does not write the
+// batches committed past its checkpoint again.
+func TableImporter[T any](db *sql.DB, opts csv.ImportOptions) Importer {
+	return ImporterFunc(func(ctx context.Context, r io.Reader, run Run) (csv.ImportResult, error) {
+		o := opts
+		o.Format = run.Format
+		o.Skip = run.Skip
+		o.Rejected = run.Rejected
+		o.Commit = csv.CommitPerBatch
+		if len(o.ConflictColumns) == 0 {
+			o.Workers = 1
+		}
+		o.OnProgress = run.OnProgress
+		o.OnRowError = run.OnRowError
+		return csv.ImportToDB[T](ctx, db, r, o)
+	})
+}
+
+// Manager accepts uploads, queues them as jobs and runs them with background
+// workers. Jobs interrupted by Stop or by a crash are resumed from their last
+// checkpoint.
+type Manager struct {
+	Store   Store
+	Storage Storage
+
+	Workers      int           // default 1
+	PollInterval time.Duration // default 2s
+	// StaleAfter is how long a running job may go without update before it
+	// is considered abandoned and requeued. Default 5 minutes.
+	StaleAfter time.Duration
+	// MaxAttempts bounds the executions of a failing job. Default 3.
+	MaxAttempts int
+	// KeepUploads keeps the uploaded file of completed jobs.
+	KeepUploads bool
+
+	ErrorLog *log.Logger
+
+	mu        sync.RWMutex
+	importers map[string]Importer
+	notify    chan struct{}
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+func NewManager(store Store, storage Storage) *Manager {
+	return &Manager{
+		Store:   store,
+		Storage: storage,
+	}
+}
+
+func (m *Manager) init() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.importers == nil {
+		m.importers = map[string]Importer{}
+	}
+	if m.notify == nil {
+		m.notify = make(chan struct{}, 1)
+	}
+	if m.Workers <= 0 {
+		m.Workers = 1
+	}
+	if m.PollInterval <= 0 {
+		m.PollInterval = 2 * time.Second
+	}
+	if m.StaleAfter <= 0 {
+		m.StaleAfter = 5 * time.Minute
+	}
+	if m.MaxAttempts <= 0 {
+		m.MaxAttempts = 3
+	}
+}
+
+// Register makes an importer available to Submit under name.
+func (m *Manager) Register(name string, imp Importer) {
+	m.init()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.importers[name] = imp
+}
+
+func (m *Manager) importer(name string) (Importer, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	imp, ok := m.importers[name]
+	return imp, ok
+}
+
+// Submit stores the upload and queues a job for the named importer. The
+// format is detected from the file name, then from the content type; an
+// undetectable one is an ErrUnsupportedFormat.
+func (m *Manager) Submit(ctx context.Context, importer, fileName, contentType string, r io.Reader) (*Job, error) {
+	m.init()
+	if _, ok := m.importer(importer); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownImporter, importer)
+	}
+
+	format, err := csv.DetectFormat(fileName, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupportedFormat, err)
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:        id,
+		Importer:  importer,
+		FileName:  fileName,
+		Format:    format.Name(),
+		Upload:    id + format.Extension(),
+		Status:    StatusQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := m.Storage.Save(job.Upload, r); err != nil {
+		return nil, fmt.Errorf("cannot store upload: %w", err)
+	}
+	if err := m.Store.Create(ctx, job); err != nil {
+		m.Storage.Remove(job.Upload)
+		return nil, err
+	}
+
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+func (m *Manager) Get(ctx context.Context, id string) (*Job, error) {
+	return m.Store.Get(ctx, id)
+}
+
+func (m *Manager) List(ctx context.Context, limit int) ([]*Job, error) {
+	return m.Store.List(ctx, limit)
+}
+
+// ErrorReport opens the CSV listing the rows rejected by a job.
+func (m *Manager) ErrorReport(ctx context.Context, id string) (io.ReadCloser, error) {
+	job, err := m.Store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.ErrorReport == "" {
+		return nil, ErrNotFound
+	}
+	return m.Storage.Open(job.ErrorReport)
+}
+
+// Start requeues abandoned jobs and launches the workers. It returns
+// immediately; call Stop to shut the workers down.
+func (m *Manager) Start(ctx context.Context) error {
+	m.init()
+
+	if _, err := m.Store.Requeue(ctx, time.Now().Add(-m.StaleAfter)); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	m.cancel = cancel
+
+	for i := 0; i < m.Workers; i++ {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.work(ctx)
+		}()
+	}
+	return nil
+}
+
+// Stop interrupts the running jobs, which are requeued, and waits for the
+// workers to return.
+func (m *Manager) Stop() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.wg.Wait()
+}
+
+func (m *Manager) work(ctx context.Context) {
+	ticker := time.NewTicker(m.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			job, err := m.Store.Claim(ctx)
+			if err != nil {
+				m.logError("import job claim:", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			m.run(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.notify:
+		case <-ticker.C:
+			// Other instances may have died with running jobs.
+			if _, err := m.Store.Requeue(ctx, time.Now().Add(-m.StaleAfter)); err != nil {
+				m.logError("import job requeue:", err)
+			}
+		}
+	}
+}
+
+func (m *Manager) run(ctx context.Context, job *Job) {
+	// Status updates must go through even when ctx is cancelled by Stop.
+	saveCtx := context.WithoutCancel(ctx)
+
+	var mu sync.Mutex
+	save := func() {
+		job.UpdatedAt = time.Now()
+		if err := m.Store.Update(saveCtx, job); err != nil {
+			m.logError("import job", job.ID, "update:", err)
+		}
+	}
+
+	mu.Lock()
+	now := time.Now()
+	job.Attempts++
+	job.Error = ""
+	if job.StartedAt == nil {
+		job.StartedAt = &now
+	}
+	save()
+	mu.Unlock()
+
+	// Heartbeat so long batches are not mistaken for abandoned jobs.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(m.StaleAfter / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				mu.Lock()
+				save()
+				mu.Unlock()
+			}
+		}
+	}()
+
+	report := &errorReport{storage: m.Storage, job: job}
+	defer report.Close()
+
+	baseWritten, baseFailed := job.Written, job.Failed
+	run := Run{
+		Job:      *job,
+		Skip:     job.Checkpoint,
+		Rejected: job.Failed,
+		OnProgress: func(p csv.Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			job.Processed = p.Checkpoint
+			job.Checkpoint = p.Checkpoint
+			job.Written = baseWritten + p.Written
+			job.Failed = baseFailed + p.Failed
+			save()
+		},
+		OnRowError: func(rowErr csv.RowError) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err := report.Write(rowErr); err != nil {
+				m.logError("import job", job.ID, "error report:", err)
+			}
+		},
+	}
+
+	err := m.execute(ctx, job, run)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	finished := time.Now()
+	switch {
+	case err == nil:
+		job.Status = StatusCompleted
+		job.FinishedAt = &finished
+		if !m.KeepUploads {
+			if err := m.Storage.Remove(job.Upload); err != nil {
+				m.logError("import job", job.ID, "remove upload:", err)
+			}
+		}
+
+	case ctx.Err() != nil:
+		// Interrupted by Stop: resume from the checkpoint on next start.
+		job.Status = StatusQueued
+		job.Attempts--
+
+	case errors.Is(err, csv.ErrTooManyRejected) || job.Attempts >= m.MaxAttempts:
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		job.FinishedAt = &finished
+		m.logError("import job", job.ID, "failed:", err)
+
+	default:
+		job.Status = StatusQueued
+		job.Error = err.Error()
+		m.logError("import job", job.ID, "attempt", job.Attempts, "failed:", err)
+	}
+	save()
+}
+
+func (m *Manager) execute(ctx context.Context, job *Job, run Run) error {
+	imp, ok := m.importer(job.Importer)
+	if !ok {
+		return fmt.Errorf("unknown importer: %s", job.Importer)
+	}
+
+	format, err := csv.FormatByName(job.Format)
+	if err != nil {
+		return err
+	}
+	run.Format = format
+
+	f, err := m.Storage.Open(job.Upload)
+	if err != nil {
+		return fmt.Errorf("cannot open upload: %w", err)
+	}
+	defer f.Close()
+
+	result, err := imp.Import(ctx, f, run)
+	if err != nil {
+		return err
+	}
+
+	if run.OnProgress != nil {
+		run.OnProgress(result.Progress)
+	}
+	return nil
+}
+
+func (m *Manager) logError(args ...any) {
+	if m.ErrorLog != nil {
+		m.ErrorLog.Println(args...)
+	}
+}
+
+// errorReport appends rejected rows to a CSV file in the job storage,
+// created on the first rejected row. Rows are flushed one by one so the
+// report stays in line with the saved checkpoint.
+type errorReport struct {
+	storage Storage
+	job     *Job
+	w       io.WriteCloser
+	csv     *stdcsv.Writer
+}
+
+func (r *errorReport) Write(rowErr csv.RowError) error {
+	if r.csv == nil {
+		fresh := r.job.ErrorReport == ""
+		if fresh {
+			r.job.ErrorReport = r.job.ID + "-errors.csv"
+		}
+		w, err := r.storage.Append(r.job.ErrorReport)
+		if err != nil {
+			return err
+		}
+		r.w = w
+		r.csv = stdcsv.NewWriter(w)
+		if fresh {
+			if err := r.csv.Write([]string{"line", "error"}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := r.csv.Write([]string{strconv.Itoa(rowErr.Line), rowErr.Err.Error()}); err != nil {
+		return err
+	}
+	r.csv.Flush()
+	return r.csv.Error()
+}
+
+func (r *errorReport) Close() error {
+	if r.w == nil {
+		return nil
+	}
+	return r.w.Close()
+}
@@ -0,0 +1,88 @@
+package jobs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Storage keeps uploaded files and error reports until the job is done.
+type Storage interface {
+	Save(name string, r io.Reader) error
+	Open(name string) (io.ReadCloser, error)
+	// Append opens name for appending, creating it when missing.
+	Append(name string) (io.WriteCloser, error)
+	Remove(name string) error
+}
+
+// DirStorage stores files in a local directory.
+type DirStorage struct {
+	Root string
+}
+
+func (s DirStorage) path(name string) (string, error) {
+	clean := filepath.Clean("/" + name)
+	if clean == "/" || strings.Contains(name, "..") {
+		return "", errors.New("invalid storage name: " + name)
+	}
+	return filepath.Join(s.Root, clean), nil
+}
+
+func (s DirStorage) Save(name string, r io.Reader) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a half-written upload is never
+	// picked up by a worker.
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s DirStorage) Open(name string) (io.ReadCloser, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (s DirStorage) Append(name string) (io.WriteCloser, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+}
+
+func (s DirStorage) Remove(name string) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
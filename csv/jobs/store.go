@@ -0,0 +1,294 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+)
+
+//
+// Memory store (single instance, lost on restart)
+//
+
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: map[string]Job{}}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = *job
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &job, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.ID]; !ok {
+		return ErrNotFound
+	}
+	s.jobs[job.ID] = *job
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, limit int) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		job := job
+		out = append(out, &job)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var oldest *Job
+	for _, job := range s.jobs {
+		if job.Status != StatusQueued {
+			continue
+		}
+		if oldest == nil || job.CreatedAt.Before(oldest.CreatedAt) {
+			job := job
+			oldest = &job
+		}
+	}
+	if oldest == nil {
+		return nil, nil
+	}
+
+	oldest.Status = StatusRunning
+	oldest.UpdatedAt = time.Now()
+	s.jobs[oldest.ID] = *oldest
+	return oldest, nil
+}
+
+func (s *MemoryStore) Requeue(ctx context.Context, staleBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for id, job := range s.jobs {
+		if job.Status == StatusRunning && job.UpdatedAt.Before(staleBefore) {
+			job.Status = StatusQueued
+			s.jobs[id] = job
+			n++
+		}
+	}
+	return n, nil
+}
+
+//
+// SQL store
+//
+
+// SQLSchema creates the table used by SQLStore (Postgres syntax).
+const SQLSchema = `CREATE TABLE IF NOT EXISTS import_jobs (
+	id           VARCHAR(32) PRIMARY KEY,
+	importer     VARCHAR(255) NOT NULL,
+	file_name    VARCHAR(255) NOT NULL,
+	format       VARCHAR(16) NOT NULL,
+	upload       VARCHAR(512) NOT NULL,
+	status       VARCHAR(16) NOT NULL,
+	processed    BIGINT NOT NULL DEFAULT 0,
+	written      BIGINT NOT NULL DEFAULT 0,
+	failed       BIGINT NOT NULL DEFAULT 0,
+	checkpoint   BIGINT NOT NULL DEFAULT 0,
+	attempts     INTEGER NOT NULL DEFAULT 0,
+	error_report VARCHAR(512) NOT NULL DEFAULT '',
+	error        TEXT NOT NULL DEFAULT '',
+	created_at   TIMESTAMP NOT NULL,
+	updated_at   TIMESTAMP NOT NULL,
+	started_at   TIMESTAMP NULL,
+	finished_at  TIMESTAMP NULL
+);
+CREATE INDEX IF NOT EXISTS import_jobs_status_idx ON import_jobs (status, created_at);`
+
+// SQLStore keeps jobs in a database table so they survive restarts and can
+// be shared between instances.
+type SQLStore struct {
+	DB          *sql.DB
+	Table       string                     // default "import_jobs"
+	Placeholder squirrel.PlaceholderFormat // default squirrel.Dollar
+}
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{DB: db, Table: "import_jobs", Placeholder: squirrel.Dollar}
+}
+
+var jobColumns = []string{
+	"id", "importer", "file_name", "format", "upload", "status",
+	"processed", "written", "failed", "checkpoint", "attempts",
+	"error_report", "error", "created_at", "updated_at", "started_at", "finished_at",
+}
+
+func (s *SQLStore) builder() squirrel.StatementBuilderType {
+	ph := s.Placeholder
+	if ph == nil {
+		ph = squirrel.Dollar
+	}
+	return squirrel.StatementBuilder.PlaceholderFormat(ph).RunWith(s.DB)
+}
+
+func (s *SQLStore) table() string {
+	if s.Table == "" {
+		return "import_jobs"
+	}
+	return s.Table
+}
+
+func scanJob(row squirrel.RowScanner) (*Job, error) {
+	var (
+		job      Job
+		started  sql.NullTime
+		finished sql.NullTime
+	)
+	err := row.Scan(&job.ID, &job.Importer, &job.FileName, &job.Format, &job.Upload, &job.Status,
+		&job.Processed, &job.Written, &job.Failed, &job.Checkpoint, &job.Attempts,
+		&job.ErrorReport, &job.Error, &job.CreatedAt, &job.UpdatedAt, &started, &finished)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if started.Valid {
+		job.StartedAt = &started.Time
+	}
+	if finished.Valid {
+		job.FinishedAt = &finished.Time
+	}
+	return &job, nil
+}
+
+func (s *SQLStore) Create(ctx context.Context, job *Job) error {
+	_, err := s.builder().Insert(s.table()).Columns(jobColumns...).
+		Values(job.ID, job.Importer, job.FileName, job.Format, job.Upload, job.Status,
+			job.Processed, job.Written, job.Failed, job.Checkpoint, job.Attempts,
+			job.ErrorReport, job.Error, job.CreatedAt, job.UpdatedAt, job.StartedAt, job.FinishedAt).
+		ExecContext(ctx)
+	return err
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (*Job, error) {
+	row := s.builder().Select(jobColumns...).From(s.table()).
+		Where(squirrel.Eq{"id": id}).QueryRowContext(ctx)
+	return scanJob(row)
+}
+
+func (s *SQLStore) Update(ctx context.Context, job *Job) error {
+	res, err := s.builder().Update(s.table()).SetMap(map[string]any{
+		"status":       job.Status,
+		"processed":    job.Processed,
+		"written":      job.Written,
+		"failed":       job.Failed,
+		"checkpoint":   job.Checkpoint,
+		"attempts":     job.Attempts,
+		"error_report": job.ErrorReport,
+		"error":        job.Error,
+		"updated_at":   job.UpdatedAt,
+		"started_at":   job.StartedAt,
+		"finished_at":  job.FinishedAt,
+	}).Where(squirrel.Eq{"id": job.ID}).ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) List(ctx context.Context, limit int) ([]*Job, error) {
+	q := s.builder().Select(jobColumns...).From(s.table()).OrderBy("created_at DESC")
+	if limit > 0 {
+		q = q.Limit(uint64(limit))
+	}
+	rows, err := q.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, job)
+	}
+	return out, rows.Err()
+}
+
+// Claim picks the oldest queued job and flips its status with a conditional
+// UPDATE; losing the race against another worker simply retries.
+func (s *SQLStore) Claim(ctx context.Context) (*Job, error) {
+	for {
+		var id string
+		err := s.builder().Select("id").From(s.table()).
+			Where(squirrel.Eq{"status": StatusQueued}).
+			OrderBy("created_at").Limit(1).
+			QueryRowContext(ctx).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := s.builder().Update(s.table()).
+			Set("status", StatusRunning).
+			Set("updated_at", time.Now()).
+			Where(squirrel.Eq{"id": id, "status": StatusQueued}).
+			ExecContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return s.Get(ctx, id)
+		}
+	}
+}
+
+func (s *SQLStore) Requeue(ctx context.Context, staleBefore time.Time) (int, error) {
+	res, err := s.builder().Update(s.table()).
+		Set("status", StatusQueued).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"status": StatusRunning}).
+		Where(squirrel.Lt{"updated_at": staleBefore}).
+		ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
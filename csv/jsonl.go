@@ -0,0 +1,196 @@
+package csv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//
+// JSON Lines (one JSON object per line)
+//
+
+type jsonLinesFormat struct{}
+
+func (jsonLinesFormat) Name() string        { return "jsonl" }
+func (jsonLinesFormat) ContentType() string { return "application/x-ndjson" }
+func (jsonLinesFormat) Extension() string   { return ".jsonl" }
+
+func (jsonLinesFormat) NewReader(r io.Reader) (RecordReader, error) {
+	jr := &jsonLinesReader{
+		reader:  bufio.NewReader(r),
+		columns: map[string]int{},
+	}
+
+	// Read the first object up front so the header is known.
+	row, err := jr.next()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	jr.pending = row
+	return jr, nil
+}
+
+func (jsonLinesFormat) NewWriter(w io.Writer) RecordWriter {
+	return &jsonLinesWriter{writer: bufio.NewWriter(w)}
+}
+
+type jsonLinesReader struct {
+	reader  *bufio.Reader
+	header  []string
+	columns map[string]int // key → header position
+	line    int
+	pending []string
+}
+
+func (r *jsonLinesReader) Header() []string { return r.header }
+func (r *jsonLinesReader) dynamicHeader()   {}
+func (r *jsonLinesReader) Line() int        { return r.line }
+
+func (r *jsonLinesReader) Read() ([]string, error) {
+	if r.pending != nil {
+		row := r.pending
+		r.pending = nil
+		return row, nil
+	}
+	return r.next()
+}
+
+// next decodes the next non-blank line. Keys are added to the header in
+// order of first appearance; nested values are kept as raw JSON.
+func (r *jsonLinesReader) next() ([]string, error) {
+	for {
+		data, err := r.reader.ReadBytes('\n')
+		if len(data) == 0 && err != nil {
+			return nil, err
+		}
+		r.line++
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		values, perr := r.parse(data)
+		if perr != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, perr)
+		}
+		return values, nil
+	}
+}
+
+func (r *jsonLinesReader) parse(data []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return nil, errors.New("expected a JSON object")
+	}
+
+	values := make([]string, len(r.header))
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+
+		idx, ok := r.columns[key]
+		if !ok {
+			idx = len(r.header)
+			r.columns[key] = idx
+			r.header = append(r.header, key)
+			values = append(values, "")
+		}
+		values[idx] = rawToString(raw)
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after JSON object")
+	}
+	return values, nil
+}
+
+// rawToString unquotes strings, maps null to an empty value and keeps any
+// other JSON value as written.
+func rawToString(raw json.RawMessage) string {
+	s := strings.TrimSpace(string(raw))
+	switch {
+	case s == "null":
+		return ""
+	case strings.HasPrefix(s, `"`):
+		var str string
+		if err := json.Unmarshal(raw, &str); err == nil {
+			return str
+		}
+	}
+	return s
+}
+
+type jsonLinesWriter struct {
+	writer *bufio.Writer
+	header []string
+}
+
+func (w *jsonLinesWriter) WriteHeader(header []string) error {
+	w.header = header
+	return nil
+}
+
+func (w *jsonLinesWriter) Write(values []any) error {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, v := range values {
+		if i >= len(w.header) {
+			break
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeJSONValue(&buf, w.header[i]); err != nil {
+			return err
+		}
+		buf.WriteByte(':')
+		if err := writeJSONValue(&buf, v); err != nil {
+			return err
+		}
+	}
+	buf.WriteString("}\n")
+
+	_, err := w.writer.Write(buf.Bytes())
+	return err
+}
+
+func (w *jsonLinesWriter) Close() error {
+	return w.writer.Flush()
+}
+
+// writeJSONValue encodes v without HTML escaping or trailing newline.
+func writeJSONValue(buf *bytes.Buffer, v any) error {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
@@ -0,0 +1,62 @@
+package csv
+
+import (
+	"time"
+
+	"github.com/socle-lab/pkg/metrics"
+)
+
+// importMetrics records the imports of ImportToDB:
+//
+//	csv_import_rows_total{table,result}     result is "written" or "rejected"
+//	csv_imports_total{table,status}         status is "ok" or "error"
+//	csv_import_duration_seconds{table}
+//
+// Rows are counted as batches commit, so rate(csv_import_rows_total) is the
+// throughput of running imports. A nil *importMetrics records nothing.
+type importMetrics struct {
+	rowsWritten, rowsRejected metrics.Counter
+	imports                   metrics.CounterVec
+	duration                  metrics.Histogram
+	table                     string
+}
+
+var importDurationBuckets = []float64{.1, .5, 1, 5, 10, 30, 60, 300, 900, 1800, 3600}
+
+func newImportMetrics(reg *metrics.Registry, table string) *importMetrics {
+	if reg == nil {
+		return nil
+	}
+	rows := reg.Counter("csv_import_rows_total", "Number of rows written or rejected by imports.", "table", "result")
+	return &importMetrics{
+		rowsWritten:  rows.With(table, "written"),
+		rowsRejected: rows.With(table, "rejected"),
+		imports:      reg.Counter("csv_imports_total", "Number of finished imports.", "table", "status"),
+		duration:     reg.Histogram("csv_import_duration_seconds", "Duration of imports.", importDurationBuckets, "table").With(table),
+		table:        table,
+	}
+}
+
+func (im *importMetrics) written(n int64) {
+	if im != nil && n > 0 {
+		im.rowsWritten.Add(float64(n))
+	}
+}
+
+func (im *importMetrics) rejected() {
+	if im != nil {
+		im.rowsRejected.Inc()
+	}
+}
+
+func (im *importMetrics) done(start time.Time, err error) {
+	if im == nil {
+		return
+	}
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	im.imports.With(im.table, status).Inc()
+	im.duration.ObserveSince(start)
+}
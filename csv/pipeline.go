@@ -0,0 +1,459 @@
+package csv
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/socle-lab/pkg/metrics"
+	"github.com/socle-lab/pkg/validator"
+)
+
+type CommitMode string
+
+const (
+	// CommitPerBatch commits every batch in its own transaction: a failure
+	// keeps the batches already written.
+	CommitPerBatch CommitMode = "batch"
+	// CommitAll runs the whole import in a single transaction that is rolled
+	// back on any failure. Batches are then written sequentially.
+	CommitAll CommitMode = "all"
+)
+
+// ErrTooManyRejected is returned when more than MaxErrors records are rejected.
+var ErrTooManyRejected = errors.New("too many rejected rows")
+
+// RowError reports a row rejected during decoding or validation.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e RowError) Unwrap() error { return e.Err }
+
+// Progress is reported after each written batch. Counters are cumulative
+// for the current run; Checkpoint also counts the skipped records.
+type Progress struct {
+	Processed int64 // records read from the input
+	Written   int64 // rows affected in the database
+	Failed    int64 // records rejected by decoding or validation
+	Batches   int64 // batches committed
+
+	// Checkpoint is the number of leading input records that are fully
+	// handled (committed or rejected). Passing it back as Skip resumes an
+	// interrupted CommitPerBatch import. With several workers, batches past
+	// the checkpoint may already be committed and are written again: resume
+	// with one worker, or make the import an upsert (ConflictColumns).
+	Checkpoint int64
+}
+
+// ImportResult summarizes a finished (or aborted) import.
+type ImportResult struct {
+	Progress
+	Errors []RowError
+}
+
+type ImportOptions struct {
+	// Format of the input, CSV by default.
+	Format Format
+	// Table is the destination table (optionally schema-qualified).
+	Table string
+	// Columns lists the written database columns, named after the `db` tag
+	// (or `csv` tag) of the struct fields. By default every column found in
+	// the header is written; for JSON Lines, whose keys may first appear on
+	// any line, every tagged field.
+	Columns []string
+	// ConflictColumns turns the insert into an upsert keyed by these columns.
+	ConflictColumns []string
+	// UpdateColumns are overwritten on conflict. When empty, conflicting rows
+	// are left untouched.
+	UpdateColumns []string
+
+	Dialect Dialect
+	Method  WriteMethod
+	Commit  CommitMode
+
+	BatchSize int // default 500
+	Workers   int // default 4, forced to 1 with CommitAll
+
+	// Skip ignores the first records of the input (see Progress.Checkpoint).
+	Skip int64
+
+	// Validate runs validator.Validate on every decoded row.
+	Validate bool
+	// MaxErrors is the number of rejected rows tolerated before aborting.
+	// Zero aborts on the first rejected row, a negative value never aborts.
+	MaxErrors int
+	// Rejected is the number of rows rejected by earlier runs of a resumed
+	// import; they count against MaxErrors.
+	Rejected int64
+
+	// OnProgress is called after each committed batch. Calls are serialized.
+	OnProgress func(Progress)
+	// OnRowError is called for each rejected record once the checkpoint
+	// covers it, in input order. Calls are serialized.
+	OnRowError func(RowError)
+
+	// Metrics, when set, records the rows written and rejected and the
+	// outcome and duration of the import (see importMetrics).
+	Metrics *metrics.Registry
+}
+
+func (o *ImportOptions) normalize() error {
+	if o.Table == "" {
+		return errors.New("table is required")
+	}
+	if o.Format == nil {
+		o.Format = CSV
+	}
+	if o.Dialect == "" {
+		o.Dialect = DialectPostgres
+	}
+	if o.Method == "" {
+		o.Method = MethodInsert
+	}
+	if o.Commit == "" {
+		o.Commit = CommitPerBatch
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 500
+	}
+	if o.Workers <= 0 {
+		o.Workers = 4
+	}
+	if o.Commit == CommitAll {
+		o.Workers = 1
+	}
+	if o.Method == MethodCopy && o.Dialect != DialectPostgres {
+		return errors.New("COPY is only supported with the postgres dialect")
+	}
+	return nil
+}
+
+// batch carries the rows to write and the records rejected since the
+// previous batch; end is the number of input records consumed so far.
+type batch struct {
+	seq    int
+	rows   [][]any
+	errors []RowError
+	end    int64
+}
+
+// checkpoint accounts batches in input order, whatever order the workers
+// finish them in.
+type checkpoint struct {
+	next int
+	done map[int]batch
+}
+
+// ImportToDB decodes rows from r into T, optionally validates them and
+// writes them to opts.Table in batches using a pool of workers.
+//
+// Cancelling ctx stops reading and writing; with CommitPerBatch the batches
+// committed so far are kept.
+func ImportToDB[T any](ctx context.Context, db *sql.DB, r io.Reader, opts ImportOptions) (ImportResult, error) {
+	im := newImportMetrics(opts.Metrics, opts.Table)
+	start := time.Now()
+	result, err := importToDB[T](ctx, db, r, opts, im)
+	im.done(start, err)
+	return result, err
+}
+
+func importToDB[T any](ctx context.Context, db *sql.DB, r io.Reader, opts ImportOptions, im *importMetrics) (ImportResult, error) {
+	var result ImportResult
+
+	if err := opts.normalize(); err != nil {
+		return result, err
+	}
+
+	dec, err := NewFormatDecoder[T](r, opts.Format)
+	if err != nil {
+		return result, err
+	}
+	if err := dec.Skip(opts.Skip); err != nil {
+		return result, err
+	}
+	result.Checkpoint = opts.Skip
+
+	mapped := dec.columns
+	if _, ok := dec.reader.(dynamicHeader); ok {
+		// The header is not known yet: write every tagged field.
+		mapped = mapColumns(dec.typ, structHeader(dec.typ))
+	}
+	columns, err := selectColumns(dec.typ, mapped, opts.Columns)
+	if err != nil {
+		return result, err
+	}
+	dbColumns := make([]string, len(columns))
+	for i, c := range columns {
+		dbColumns[i] = c.db
+	}
+
+	suffix, err := opts.Dialect.upsertSuffix(opts.ConflictColumns, opts.UpdateColumns)
+	if err != nil {
+		return result, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var tx *sql.Tx
+	if opts.Commit == CommitAll {
+		tx, err = db.BeginTx(ctx, nil)
+		if err != nil {
+			return result, err
+		}
+		defer tx.Rollback()
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		cp       = checkpoint{next: 1, done: map[int]batch{}}
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	write := func(b batch) (int64, error) {
+		if len(b.rows) == 0 {
+			return 0, nil
+		}
+		if tx != nil {
+			return writeBatch(ctx, tx, opts, dbColumns, suffix, b)
+		}
+
+		btx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, err
+		}
+		n, err := writeBatch(ctx, btx, opts, dbColumns, suffix, b)
+		if err != nil {
+			btx.Rollback()
+			return 0, err
+		}
+		return n, btx.Commit()
+	}
+
+	// commit records a written batch and advances the checkpoint over every
+	// contiguous batch. Must be called with mu held.
+	commit := func(b batch, written int64) {
+		result.Written += written
+		im.written(written)
+		if len(b.rows) > 0 {
+			result.Batches++
+		}
+
+		cp.done[b.seq] = b
+		for {
+			done, ok := cp.done[cp.next]
+			if !ok {
+				break
+			}
+			delete(cp.done, cp.next)
+			cp.next++
+
+			for _, rowErr := range done.errors {
+				result.Failed++
+				im.rejected()
+				result.Errors = append(result.Errors, rowErr)
+				if opts.OnRowError != nil {
+					opts.OnRowError(rowErr)
+				}
+			}
+			result.Checkpoint = opts.Skip + done.end
+		}
+
+		if opts.OnProgress != nil {
+			opts.OnProgress(result.Progress)
+		}
+	}
+
+	batches := make(chan batch, opts.Workers)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				n, err := write(b)
+				if err != nil {
+					fail(fmt.Errorf("batch %d: %w", b.seq, err))
+					continue
+				}
+
+				mu.Lock()
+				commit(b, n)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	readErr := func() error {
+		defer close(batches)
+
+		var (
+			seq      int
+			consumed int64
+			rejected = opts.Rejected
+			rows     = make([][]any, 0, opts.BatchSize)
+			pending  []RowError
+		)
+		flush := func() bool {
+			if len(rows) == 0 && len(pending) == 0 {
+				return true
+			}
+			seq++
+			select {
+			case batches <- batch{seq: seq, rows: rows, errors: pending, end: consumed}:
+				rows = make([][]any, 0, opts.BatchSize)
+				pending = nil
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		reject := func(rowErr RowError) error {
+			pending = append(pending, rowErr)
+			rejected++
+			if opts.MaxErrors >= 0 && rejected > int64(opts.MaxErrors) {
+				return fmt.Errorf("%w: %w", ErrTooManyRejected, rowErr)
+			}
+			return nil
+		}
+
+		for {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			row, err := dec.Decode()
+			if err == io.EOF {
+				flush()
+				return nil
+			}
+
+			consumed++
+			mu.Lock()
+			result.Processed++
+			mu.Unlock()
+
+			var fe *FieldError
+			if errors.As(err, &fe) {
+				if err := reject(RowError{Line: fe.Line, Err: fe}); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if opts.Validate {
+				if err := validator.Check(ctx, row); err != nil {
+					if !validator.IsValidationError(err) {
+						return err
+					}
+					if err := reject(RowError{Line: dec.Line(), Err: err}); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+
+			rows = append(rows, rowValues(reflect.ValueOf(row), columns))
+			if len(rows) >= opts.BatchSize && !flush() {
+				return nil
+			}
+		}
+	}()
+	if readErr != nil {
+		fail(readErr)
+	}
+
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		// The parent context was cancelled.
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		return result, firstErr
+	}
+
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func writeBatch(ctx context.Context, tx *sql.Tx, opts ImportOptions, columns []string, suffix string, b batch) (int64, error) {
+	if opts.Method == MethodCopy {
+		return copyBatch(ctx, tx, opts.Dialect, opts.Table, columns, b.rows, opts.ConflictColumns, opts.UpdateColumns, b.seq)
+	}
+	return insertBatch(ctx, tx, opts.Dialect, opts.Table, columns, b.rows, suffix)
+}
+
+// selectColumns keeps the columns named in wanted, looked up among every
+// tagged field of t. Without wanted, the columns mapped from the header are
+// used. Fields tagged `db:"-"` are never written.
+func selectColumns(t reflect.Type, mapped []column, wanted []string) ([]column, error) {
+	var out []column
+	if len(wanted) == 0 {
+		for _, c := range mapped {
+			if c.db != "-" {
+				out = append(out, c)
+			}
+		}
+	} else {
+		tagged := mapColumns(t, structHeader(t))
+		for _, w := range wanted {
+			found := false
+			for _, c := range tagged {
+				if c.db == w && c.db != "-" {
+					out = append(out, c)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("column %q is not mapped to a struct field", w)
+			}
+		}
+	}
+
+	if len(out) == 0 {
+		return nil, errors.New("no column is mapped to a database column")
+	}
+	return out, nil
+}
+
+func rowValues(v reflect.Value, columns []column) []any {
+	values := make([]any, len(columns))
+	for i, c := range columns {
+		f := v.Field(c.field)
+		if f.Kind() == reflect.Ptr && f.IsNil() {
+			values[i] = nil
+			continue
+		}
+		values[i] = f.Interface()
+	}
+	return values
+}
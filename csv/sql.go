@@ -0,0 +1,210 @@
+package csv
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+)
+
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgres"
+	DialectMySQL    Dialect = "mysql"
+	DialectSQLite   Dialect = "sqlite"
+)
+
+type WriteMethod string
+
+const (
+	// MethodInsert writes each batch with a single multi-row INSERT.
+	MethodInsert WriteMethod = "insert"
+	// MethodCopy streams each batch with Postgres COPY FROM STDIN. It needs a
+	// driver exposing COPY through prepared statements (lib/pq).
+	MethodCopy WriteMethod = "copy"
+)
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+func (d Dialect) placeholder() squirrel.PlaceholderFormat {
+	if d == DialectPostgres {
+		return squirrel.Dollar
+	}
+	return squirrel.Question
+}
+
+func (d Dialect) quote(ident string) string {
+	parts := strings.Split(ident, ".")
+	for i, p := range parts {
+		if d == DialectMySQL {
+			parts[i] = "`" + strings.ReplaceAll(p, "`", "``") + "`"
+		} else {
+			parts[i] = `"` + strings.ReplaceAll(p, `"`, `""`) + `"`
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func (d Dialect) quoteAll(idents []string) []string {
+	out := make([]string, len(idents))
+	for i, id := range idents {
+		out[i] = d.quote(id)
+	}
+	return out
+}
+
+// upsertSuffix builds the conflict clause appended to the INSERT statement.
+func (d Dialect) upsertSuffix(conflict, update []string) (string, error) {
+	if len(conflict) == 0 {
+		return "", nil
+	}
+
+	switch d {
+	case DialectMySQL:
+		// MySQL resolves conflicts on any unique key; the declared columns
+		// only matter for the update list.
+		if len(update) == 0 {
+			update = conflict[:1]
+		}
+		sets := make([]string, len(update))
+		for i, c := range update {
+			sets[i] = fmt.Sprintf("%s = VALUES(%s)", d.quote(c), d.quote(c))
+		}
+		return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", "), nil
+
+	case DialectPostgres, DialectSQLite:
+		target := strings.Join(d.quoteAll(conflict), ", ")
+		if len(update) == 0 {
+			return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", target), nil
+		}
+		sets := make([]string, len(update))
+		for i, c := range update {
+			sets[i] = fmt.Sprintf("%s = EXCLUDED.%s", d.quote(c), d.quote(c))
+		}
+		return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", target, strings.Join(sets, ", ")), nil
+
+	default:
+		return "", fmt.Errorf("unsupported dialect: %s", d)
+	}
+}
+
+// maxParams is the number of bind parameters a statement may carry.
+func (d Dialect) maxParams() int {
+	if d == DialectSQLite {
+		return 32766
+	}
+	return 65535
+}
+
+// insertBatch writes rows with multi-row INSERT statements, as few as the
+// bind parameter limit of the dialect allows.
+func insertBatch(ctx context.Context, db execer, d Dialect, table string, columns []string, rows [][]any, suffix string) (int64, error) {
+	size := len(rows)
+	if len(columns) > 0 {
+		size = max(1, d.maxParams()/len(columns))
+	}
+
+	var total int64
+	for len(rows) > 0 {
+		chunk := rows[:min(size, len(rows))]
+		rows = rows[len(chunk):]
+		n, err := insertRows(ctx, db, d, table, columns, chunk, suffix)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func insertRows(ctx context.Context, db execer, d Dialect, table string, columns []string, rows [][]any, suffix string) (int64, error) {
+	q := squirrel.Insert(d.quote(table)).
+		Columns(d.quoteAll(columns)...).
+		PlaceholderFormat(d.placeholder())
+	for _, row := range rows {
+		q = q.Values(row...)
+	}
+	if suffix != "" {
+		q = q.Suffix(suffix)
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		// Not every driver reports affected rows; assume the whole batch.
+		return int64(len(rows)), nil
+	}
+	return n, nil
+}
+
+// copyBatch writes rows with Postgres COPY. When conflict columns are set the
+// rows are copied into a temporary staging table first and then upserted,
+// since COPY itself cannot resolve conflicts.
+func copyBatch(ctx context.Context, tx execer, d Dialect, table string, columns []string, rows [][]any, conflict, update []string, batch int) (int64, error) {
+	if d != DialectPostgres {
+		return 0, errors.New("COPY is only supported with the postgres dialect")
+	}
+
+	target := table
+	if len(conflict) > 0 {
+		target = fmt.Sprintf("csv_import_stage_%d", batch)
+		stage := fmt.Sprintf("CREATE TEMP TABLE %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP", d.quote(target), d.quote(table))
+		if _, err := tx.ExecContext(ctx, stage); err != nil {
+			return 0, fmt.Errorf("cannot create staging table: %w", err)
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("COPY %s (%s) FROM STDIN", d.quote(target), strings.Join(d.quoteAll(columns), ", ")))
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			stmt.Close()
+			return 0, err
+		}
+	}
+	// An empty Exec flushes the buffered COPY data.
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return 0, err
+	}
+	if err := stmt.Close(); err != nil {
+		return 0, err
+	}
+
+	if len(conflict) == 0 {
+		return int64(len(rows)), nil
+	}
+
+	suffix, err := d.upsertSuffix(conflict, update)
+	if err != nil {
+		return 0, err
+	}
+	cols := strings.Join(d.quoteAll(columns), ", ")
+	res, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s %s",
+		d.quote(table), cols, cols, d.quote(target), suffix))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "DROP TABLE "+d.quote(target)); err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,475 @@
+package csv
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// XLSX (Office Open XML spreadsheet)
+//
+
+// XLSXFormat reads the first worksheet, or the one named Sheet, and writes a
+// single worksheet named Sheet ("Sheet1" by default).
+type XLSXFormat struct {
+	Sheet string
+	// MaxBytes bounds the size of the file read (default 100mb).
+	MaxBytes int64
+}
+
+const (
+	defaultXLSXMaxBytes = 100 << 20
+	// xlsxMaxColumns is the last column of a worksheet (XFD).
+	xlsxMaxColumns = 16384
+)
+
+func (XLSXFormat) Name() string { return "xlsx" }
+func (XLSXFormat) ContentType() string {
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+func (XLSXFormat) Extension() string { return ".xlsx" }
+
+// XLSXSheet returns the XLSX format bound to a named worksheet.
+func XLSXSheet(name string) Format {
+	return XLSXFormat{Sheet: name}
+}
+
+const relationshipsNS = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var sb strings.Builder
+	for _, r := range t.Runs {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+type xlsxCell struct {
+	Ref    string   `xml:"r,attr"`
+	Type   string   `xml:"t,attr"`
+	Value  string   `xml:"v"`
+	Inline xlsxText `xml:"is"`
+}
+
+type xlsxRow struct {
+	Num   int        `xml:"r,attr"`
+	Cells []xlsxCell `xml:"c"`
+}
+
+// NewReader loads the archive in memory (zip needs random access) and then
+// streams the worksheet rows.
+func (f XLSXFormat) NewReader(r io.Reader) (RecordReader, error) {
+	max := f.MaxBytes
+	if max <= 0 {
+		max = defaultXLSXMaxBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("xlsx file larger than %d bytes", max)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, zf := range zr.File {
+		files[zf.Name] = zf
+	}
+
+	shared, err := readSharedStrings(files["xl/sharedStrings.xml"])
+	if err != nil {
+		return nil, err
+	}
+
+	sheetPath, err := f.sheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+	sheet, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("invalid xlsx file: missing %s", sheetPath)
+	}
+	rc, err := sheet.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	xr := &xlsxReader{
+		closer:  rc,
+		decoder: xml.NewDecoder(rc),
+		shared:  shared,
+	}
+
+	header, err := xr.Read()
+	if err != nil {
+		rc.Close()
+		if err == io.EOF {
+			return nil, errors.New("cannot read header: empty sheet")
+		}
+		return nil, fmt.Errorf("cannot read header: %w", err)
+	}
+	for len(header) > 0 && strings.TrimSpace(header[len(header)-1]) == "" {
+		header = header[:len(header)-1]
+	}
+	xr.header = header
+
+	return xr, nil
+}
+
+// sheetPath resolves the worksheet part through workbook.xml and its
+// relationships.
+func (f XLSXFormat) sheetPath(files map[string]*zip.File) (string, error) {
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeZipXML(files["xl/workbook.xml"], &workbook); err != nil {
+		return "", fmt.Errorf("invalid xlsx workbook: %w", err)
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("xlsx workbook has no sheet")
+	}
+
+	rid := workbook.Sheets[0].RID
+	if f.Sheet != "" {
+		rid = ""
+		for _, s := range workbook.Sheets {
+			if strings.EqualFold(s.Name, f.Sheet) {
+				rid = s.RID
+				break
+			}
+		}
+		if rid == "" {
+			return "", fmt.Errorf("xlsx sheet %q not found", f.Sheet)
+		}
+	}
+
+	var rels struct {
+		Items []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeZipXML(files["xl/_rels/workbook.xml.rels"], &rels); err != nil {
+		return "", fmt.Errorf("invalid xlsx relationships: %w", err)
+	}
+	for _, rel := range rels.Items {
+		if rel.ID != rid {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return "", fmt.Errorf("xlsx relationship %s not found", rid)
+}
+
+func readSharedStrings(f *zip.File) ([]string, error) {
+	if f == nil {
+		return nil, nil
+	}
+	var sst struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if err := decodeZipXML(f, &sst); err != nil {
+		return nil, fmt.Errorf("invalid xlsx shared strings: %w", err)
+	}
+	out := make([]string, len(sst.Items))
+	for i, si := range sst.Items {
+		out[i] = si.String()
+	}
+	return out, nil
+}
+
+func decodeZipXML(f *zip.File, v any) error {
+	if f == nil {
+		return errors.New("missing part")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+type xlsxReader struct {
+	closer  io.Closer
+	decoder *xml.Decoder
+	shared  []string
+	header  []string
+	line    int
+}
+
+func (r *xlsxReader) Header() []string { return r.header }
+func (r *xlsxReader) Line() int        { return r.line }
+
+// Read returns the next non-empty row. The worksheet is closed at EOF.
+func (r *xlsxReader) Read() ([]string, error) {
+	for {
+		tok, err := r.decoder.Token()
+		if err != nil {
+			r.closer.Close()
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var row xlsxRow
+		if err := r.decoder.DecodeElement(&row, &start); err != nil {
+			return nil, err
+		}
+		if row.Num > 0 {
+			r.line = row.Num
+		} else {
+			r.line++
+		}
+
+		values, err := r.values(row)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		return values, nil
+	}
+}
+
+func (r *xlsxReader) values(row xlsxRow) ([]string, error) {
+	var values []string
+	for i, c := range row.Cells {
+		idx := i
+		if c.Ref != "" {
+			col, err := columnIndex(c.Ref)
+			if err != nil {
+				return nil, err
+			}
+			idx = col
+		}
+		for len(values) <= idx {
+			values = append(values, "")
+		}
+
+		switch c.Type {
+		case "s":
+			n, err := strconv.Atoi(strings.TrimSpace(c.Value))
+			if err != nil || n < 0 || n >= len(r.shared) {
+				return nil, fmt.Errorf("cell %s: invalid shared string index %q", c.Ref, c.Value)
+			}
+			values[idx] = r.shared[n]
+		case "inlineStr":
+			values[idx] = c.Inline.String()
+		case "b":
+			values[idx] = strconv.FormatBool(strings.TrimSpace(c.Value) == "1")
+		default:
+			values[idx] = c.Value
+		}
+	}
+	return values, nil
+}
+
+// columnIndex converts the letters of a cell reference ("AB12") to a
+// zero-based column index.
+func columnIndex(ref string) (int, error) {
+	n := 0
+	i := 0
+	for ; i < len(ref); i++ {
+		ch := ref[i]
+		if ch >= 'a' && ch <= 'z' {
+			ch -= 'a' - 'A'
+		}
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		n = n*26 + int(ch-'A'+1)
+		if n > xlsxMaxColumns {
+			return 0, fmt.Errorf("invalid cell reference %q: column beyond XFD", ref)
+		}
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return n - 1, nil
+}
+
+func columnName(idx int) string {
+	name := ""
+	for idx >= 0 {
+		name = string(rune('A'+idx%26)) + name
+		idx = idx/26 - 1
+	}
+	return name
+}
+
+// excelEpoch is day zero of the 1900 date system (accounting for the
+// 1900 leap year bug).
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// excelSerialToTime converts an Excel date serial (e.g. 45292.5) to a time.
+func excelSerialToTime(serial float64) time.Time {
+	days := int(serial)
+	frac := serial - float64(days)
+	return excelEpoch.AddDate(0, 0, days).Add(time.Duration(frac * float64(24*time.Hour)).Round(time.Second))
+}
+
+//
+// Writer
+//
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>`
+
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="` + relationshipsNS + `"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`
+
+	xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts><fills count="1"><fill><patternFill patternType="none"/></fill></fills><borders count="1"><border/></borders><cellStyleXfs count="1"><xf/></cellStyleXfs><cellXfs count="1"><xf xfId="0"/></cellXfs></styleSheet>`
+
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+func (f XLSXFormat) NewWriter(w io.Writer) RecordWriter {
+	sheet := f.Sheet
+	if sheet == "" {
+		sheet = "Sheet1"
+	}
+	return &xlsxWriter{zip: zip.NewWriter(w), sheet: sheet}
+}
+
+// xlsxWriter streams rows into the worksheet part, which is written last.
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet string
+	out   *bufio.Writer
+	row   int
+}
+
+func (w *xlsxWriter) start() error {
+	if w.out != nil {
+		return nil
+	}
+
+	var name bytes.Buffer
+	if err := xml.EscapeText(&name, []byte(w.sheet)); err != nil {
+		return err
+	}
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, name.String())},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, p := range parts {
+		fw, err := w.zip.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, p.body); err != nil {
+			return err
+		}
+	}
+
+	fw, err := w.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	w.out = bufio.NewWriter(fw)
+	_, err = w.out.WriteString(xlsxSheetStart)
+	return err
+}
+
+func (w *xlsxWriter) WriteHeader(header []string) error {
+	values := make([]any, len(header))
+	for i, h := range header {
+		values[i] = h
+	}
+	return w.Write(values)
+}
+
+func (w *xlsxWriter) Write(values []any) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	w.row++
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<row r="%d">`, w.row)
+	for i, v := range values {
+		ref := columnName(i) + strconv.Itoa(w.row)
+		switch v := v.(type) {
+		case nil:
+			continue
+		case bool:
+			b := 0
+			if v {
+				b = 1
+			}
+			fmt.Fprintf(&buf, `<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			fmt.Fprintf(&buf, `<c r="%s"><v>%s</v></c>`, ref, formatValue(v))
+		default:
+			fmt.Fprintf(&buf, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			if err := xml.EscapeText(&buf, []byte(formatValue(v))); err != nil {
+				return err
+			}
+			buf.WriteString(`</t></is></c>`)
+		}
+	}
+	buf.WriteString(`</row>`)
+
+	_, err := w.out.Write(buf.Bytes())
+	return err
+}
+
+func (w *xlsxWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if _, err := w.out.WriteString(xlsxSheetEnd); err != nil {
+		return err
+	}
+	if err := w.out.Flush(); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
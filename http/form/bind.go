@@ -0,0 +1,524 @@
+package form
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/socle-lab/pkg/util"
+)
+
+// FieldError is a form value that could not be bound to its field. Tag
+// names the failed rule ("type" for unparsable values, "maxsize", "mimetypes"
+// or "maxfiles" for uploads) and Param its parameter.
+type FieldError struct {
+	Field string
+	Tag   string
+	Param string
+	Value string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	if e.Tag != "type" {
+		return fmt.Sprintf("invalid %s: %v", e.Field, e.Err)
+	}
+	return fmt.Sprintf("invalid value %q for %s: %v", e.Value, e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// BindErrors collects the field errors of a bind, in field order.
+type BindErrors []*FieldError
+
+func (e BindErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Layouts tried for time.Time fields without a `layout` tag; they cover the
+// values of date, time and datetime-local inputs.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"15:04",
+}
+
+// BindValues fills dst, a pointer to a struct, from values.
+//
+// Fields are named by their `form` tag (`form:"-"` skips them), else by
+// their snake_cased name. Nested structs use dotted or bracketed keys
+// (address.city or address[city]), slices take repeated keys (tags=a&tags=b,
+// tags[]=a) or indexed ones (items[0].name), maps take bracketed keys
+// (meta[color]). Scalars of every kind, time.Time (honoring a `layout` tag)
+// and encoding.TextUnmarshaler fields are supported; pointers stay nil when
+// their key is absent.
+//
+// Absent keys leave fields untouched, empty values reset them to their zero
+// value. Invalid values don't stop the bind: they are returned together as
+// BindErrors.
+func BindValues(values url.Values, dst any) error {
+	return bind(values, nil, dst)
+}
+
+// BindMultipart fills dst from a parsed multipart form: values as
+// BindValues does, and uploaded files (see bindFile).
+func BindMultipart(form *multipart.Form, dst any) error {
+	return bind(form.Value, form.File, dst)
+}
+
+func bind(values url.Values, files map[string][]*multipart.FileHeader, dst any) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("form: destination must be a non-nil pointer to a struct")
+	}
+	if err := checkFileTags(rv.Elem().Type()); err != nil {
+		return err
+	}
+
+	b := &binder{
+		values: make(map[string][]string, len(values)),
+		files:  make(map[string][]*multipart.FileHeader, len(files)),
+	}
+	for k, v := range values {
+		key := normalizeKey(k)
+		b.values[key] = append(b.values[key], v...)
+	}
+	for k, v := range files {
+		key := normalizeKey(k)
+		b.files[key] = append(b.files[key], v...)
+	}
+	b.bindStruct(rv.Elem(), "")
+
+	if len(b.errs) > 0 {
+		return b.errs
+	}
+	return nil
+}
+
+type binder struct {
+	values map[string][]string
+	files  map[string][]*multipart.FileHeader
+	errs   BindErrors
+}
+
+// normalizeKey rewrites bracketed keys into the dotted form used while
+// binding: a[b][0][c] becomes a.b[0].c and a trailing [] is dropped.
+func normalizeKey(key string) string {
+	if !strings.Contains(key, "[") {
+		return key
+	}
+
+	var sb strings.Builder
+	for {
+		open := strings.IndexByte(key, '[')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(key[open:], ']')
+		if end < 0 {
+			break
+		}
+		end += open
+
+		sb.WriteString(key[:open])
+		inner := key[open+1 : end]
+		switch {
+		case inner == "":
+		case isIndex(inner):
+			sb.WriteString(key[open : end+1])
+		default:
+			sb.WriteByte('.')
+			sb.WriteString(inner)
+		}
+		key = key[end+1:]
+	}
+	sb.WriteString(key)
+	return sb.String()
+}
+
+func isIndex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// present reports whether values hold key or keys nested under it.
+func (b *binder) present(key string) bool {
+	if _, ok := b.values[key]; ok {
+		return true
+	}
+	if _, ok := b.files[key]; ok {
+		return true
+	}
+	for k := range b.values {
+		if strings.HasPrefix(k, key) && len(k) > len(key) && (k[len(key)] == '.' || k[len(key)] == '[') {
+			return true
+		}
+	}
+	return false
+}
+
+// indices returns the distinct indexes used under key[...], sorted.
+func (b *binder) indices(key string) []int {
+	seen := map[int]bool{}
+	for k := range b.values {
+		if !strings.HasPrefix(k, key+"[") {
+			continue
+		}
+		rest := k[len(key)+1:]
+		end := strings.IndexByte(rest, ']')
+		if end < 0 || !isIndex(rest[:end]) {
+			continue
+		}
+		if i, err := strconv.Atoi(rest[:end]); err == nil {
+			seen[i] = true
+		}
+	}
+
+	out := make([]int, 0, len(seen))
+	for i := range seen {
+		out = append(out, i)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// mapKeys returns the distinct keys used under key.xxx, sorted.
+func (b *binder) mapKeys(key string) []string {
+	seen := map[string]bool{}
+	for k := range b.values {
+		if !strings.HasPrefix(k, key+".") {
+			continue
+		}
+		rest := k[len(key)+1:]
+		if end := strings.IndexAny(rest, ".["); end >= 0 {
+			rest = rest[:end]
+		}
+		seen[rest] = true
+	}
+
+	out := make([]string, 0, len(seen))
+	for k := range seen {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (b *binder) fail(key, value string, err error) {
+	b.errs = append(b.errs, &FieldError{Field: key, Tag: "type", Value: value, Err: err})
+}
+
+func (b *binder) bindStruct(v reflect.Value, prefix string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		f := v.Field(i)
+
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !isScalar(ft) {
+				if f.Kind() == reflect.Ptr {
+					if !field.IsExported() {
+						continue
+					}
+					if f.IsNil() {
+						f.Set(reflect.New(ft))
+					}
+					f = f.Elem()
+				}
+				b.bindStruct(f, prefix)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = util.ToSnakeCase(field.Name)
+		}
+		b.bindField(f, prefix+name, field.Tag)
+	}
+}
+
+func (b *binder) bindField(f reflect.Value, key string, tag reflect.StructTag) {
+	t := f.Type()
+
+	switch {
+	case t == fileHeaderType || t == fileHeadersType:
+		b.bindFile(f, key, tag)
+
+	case isScalar(t):
+		if vals, ok := b.values[key]; ok && len(vals) > 0 {
+			b.setScalar(f, key, vals[0], tag.Get("layout"))
+		}
+
+	case t.Kind() == reflect.Ptr:
+		if !b.present(key) {
+			return
+		}
+		if f.IsNil() {
+			f.Set(reflect.New(t.Elem()))
+		}
+		b.bindField(f.Elem(), key, tag)
+
+	case t.Kind() == reflect.Struct:
+		if b.present(key) {
+			b.bindStruct(f, key+".")
+		}
+
+	case t.Kind() == reflect.Slice:
+		b.bindSlice(f, key, tag)
+
+	case t.Kind() == reflect.Map:
+		b.bindMap(f, key, tag)
+	}
+}
+
+func (b *binder) bindSlice(f reflect.Value, key string, tag reflect.StructTag) {
+	t := f.Type()
+
+	// Repeated keys: tags=a&tags=b (or tags[]=a&tags[]=b).
+	if vals, ok := b.values[key]; ok && isScalar(t.Elem()) {
+		out := reflect.MakeSlice(t, 0, len(vals))
+		for i, raw := range vals {
+			if raw == "" && underlying(t.Elem()).Kind() != reflect.String {
+				continue // the hidden input sent to clear a checkbox group
+			}
+			elem := reflect.New(t.Elem()).Elem()
+			if b.setScalar(elem, fmt.Sprintf("%s[%d]", key, i), raw, tag.Get("layout")) {
+				out = reflect.Append(out, elem)
+			}
+		}
+		f.Set(out)
+		return
+	}
+
+	// Indexed keys: items[0].name, items[1].name; gaps are dropped.
+	indices := b.indices(key)
+	if len(indices) == 0 {
+		return
+	}
+	out := reflect.MakeSlice(t, len(indices), len(indices))
+	for i, idx := range indices {
+		elemKey := fmt.Sprintf("%s[%d]", key, idx)
+		if i < f.Len() {
+			out.Index(i).Set(f.Index(i))
+		}
+		b.bindField(out.Index(i), elemKey, tag)
+	}
+	f.Set(out)
+}
+
+func (b *binder) bindMap(f reflect.Value, key string, tag reflect.StructTag) {
+	t := f.Type()
+	keys := b.mapKeys(key)
+	if len(keys) == 0 {
+		return
+	}
+	if !isScalar(t.Key()) {
+		b.fail(key, "", fmt.Errorf("unsupported map key type %s", t.Key()))
+		return
+	}
+	if f.IsNil() {
+		f.Set(reflect.MakeMapWithSize(t, len(keys)))
+	}
+
+	for _, k := range keys {
+		mk := reflect.New(t.Key()).Elem()
+		if !b.setScalar(mk, key, k, "") {
+			continue
+		}
+		elem := reflect.New(t.Elem()).Elem()
+		if existing := f.MapIndex(mk); existing.IsValid() {
+			elem.Set(existing)
+		}
+		failed := len(b.errs)
+		b.bindField(elem, key+"."+k, tag)
+		if len(b.errs) == failed {
+			f.SetMapIndex(mk, elem)
+		}
+	}
+}
+
+// isScalar reports whether t (or what it points to) is bound from a single
+// value.
+func isScalar(t reflect.Type) bool {
+	t = underlying(t)
+	if t == timeType || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8 // []byte
+	}
+	return false
+}
+
+func underlying(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// setScalar parses raw into f, recording a field error on failure.
+func (b *binder) setScalar(f reflect.Value, key, raw, layout string) bool {
+	t := f.Type()
+
+	if t.Kind() == reflect.Ptr {
+		if raw == "" && underlying(t).Kind() != reflect.String {
+			f.Set(reflect.Zero(t))
+			return true
+		}
+		v := reflect.New(t.Elem())
+		if !b.setScalar(v.Elem(), key, raw, layout) {
+			return false
+		}
+		f.Set(v)
+		return true
+	}
+
+	if raw == "" && t.Kind() != reflect.String {
+		f.Set(reflect.Zero(t))
+		return true
+	}
+
+	if t == timeType {
+		tm, err := parseTime(raw, layout)
+		if err != nil {
+			b.fail(key, raw, err)
+			return false
+		}
+		f.Set(reflect.ValueOf(tm))
+		return true
+	}
+
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		v := reflect.New(t)
+		if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw)); err != nil {
+			b.fail(key, raw, err)
+			return false
+		}
+		f.Set(v.Elem())
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		f.SetString(raw)
+
+	case reflect.Bool:
+		v, err := parseBool(raw)
+		if err != nil {
+			b.fail(key, raw, err)
+			return false
+		}
+		f.SetBool(v)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, t.Bits())
+		if err != nil {
+			b.fail(key, raw, numError(err, "integer"))
+			return false
+		}
+		f.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(strings.TrimSpace(raw), 10, t.Bits())
+		if err != nil {
+			b.fail(key, raw, numError(err, "unsigned integer"))
+			return false
+		}
+		f.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(raw), ",", "."), t.Bits())
+		if err != nil {
+			b.fail(key, raw, numError(err, "number"))
+			return false
+		}
+		f.SetFloat(n)
+
+	case reflect.Slice: // []byte
+		f.SetBytes([]byte(raw))
+
+	default:
+		b.fail(key, raw, fmt.Errorf("unsupported type %s", t))
+		return false
+	}
+	return true
+}
+
+func numError(err error, kind string) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return fmt.Errorf("%s out of range", kind)
+	}
+	return fmt.Errorf("not a valid %s", kind)
+}
+
+func parseBool(raw string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "1", "true", "on", "yes", "oui":
+		return true, nil
+	case "0", "false", "off", "no", "non":
+		return false, nil
+	}
+	return false, errors.New("not a valid boolean")
+}
+
+func parseTime(raw, layout string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if layout != "" {
+		t, err := time.Parse(layout, raw)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("expected a time formatted as %s", layout)
+		}
+		return t, nil
+	}
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l, raw); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("not a valid date or time")
+}
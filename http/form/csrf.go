@@ -0,0 +1,58 @@
+package form
+
+import (
+	"context"
+	"html"
+	"html/template"
+
+	"github.com/socle-lab/render"
+)
+
+// CSRFFieldName is the form field carrying the CSRF token.
+var CSRFFieldName = "csrf_token"
+
+type csrfKey struct{}
+
+// WithCSRFToken returns a copy of ctx carrying the CSRF token of the request
+// (set by the CSRF middleware).
+func WithCSRFToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, csrfKey{}, token)
+}
+
+// CSRFToken returns the CSRF token to send back with the request's forms or
+// in the X-CSRF-Token header of fetch requests, or "" without the CSRF
+// middleware.
+func CSRFToken(ctx context.Context) string {
+	token, _ := ctx.Value(csrfKey{}).(string)
+	return token
+}
+
+// CSRFField returns the hidden input carrying the CSRF token.
+func CSRFField(ctx context.Context) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + html.EscapeString(CSRFFieldName) +
+		`" value="` + html.EscapeString(CSRFToken(ctx)) + `">`)
+}
+
+// CSRFPageOptions exposes the CSRF token to the page: csrfToken() and
+// csrfField() in Jet, Data["csrf_token"] in the template data. The renderers
+// fill TemplateData.CSRFToken from nosurf, so templates using .CSRFToken
+// get the nosurf token: with the CSRF middleware, replace it with
+// csrfField() or {{ .Data.csrf_token }}. Like State.PageOptions, it sets
+// them on copies of the caller's VarMap and TemplateData.
+func CSRFPageOptions(ctx context.Context, opts render.PageOptions) render.PageOptions {
+	token := CSRFToken(ctx)
+	if token == "" {
+		return opts
+	}
+
+	if vars, ok := pageVars(opts); ok {
+		vars.Set("csrfToken", func() string { return token })
+		vars.Set("csrfField", func() template.HTML { return CSRFField(ctx) })
+		opts.Variables = vars
+	}
+	if td, ok := pageData(opts); ok {
+		td.Data["csrf_token"] = token
+		opts.Data = td
+	}
+	return opts
+}
@@ -0,0 +1,258 @@
+package form
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+// fileRules are the limits declared by the `file` tag, e.g.
+//
+//	Avatar *multipart.FileHeader   `form:"avatar" file:"maxsize=2MB,types=image/png|image/jpeg"`
+//	Docs   []*multipart.FileHeader `form:"docs" file:"maxsize=10MB,types=application/pdf|image/*,maxfiles=5"`
+type fileRules struct {
+	maxSize    int64
+	maxSizeRaw string
+	types      []string
+	typesRaw   string
+	maxFiles   int
+}
+
+func parseFileRules(tag string) (fileRules, error) {
+	var rules fileRules
+	for _, rule := range strings.Split(tag, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		name, param, _ := strings.Cut(rule, "=")
+
+		switch name {
+		case "maxsize":
+			n, err := ParseSize(param)
+			if err != nil {
+				return rules, err
+			}
+			rules.maxSize, rules.maxSizeRaw = n, param
+		case "types":
+			for _, t := range strings.Split(param, "|") {
+				if t = strings.TrimSpace(strings.ToLower(t)); t != "" {
+					rules.types = append(rules.types, t)
+				}
+			}
+			rules.typesRaw = param
+		case "maxfiles":
+			n, err := strconv.Atoi(param)
+			if err != nil || n < 1 {
+				return rules, fmt.Errorf("invalid maxfiles %q", param)
+			}
+			rules.maxFiles = n
+		default:
+			return rules, fmt.Errorf("unknown file rule %q", name)
+		}
+	}
+	return rules, nil
+}
+
+var (
+	fileRulesCache  sync.Map // tag → parsedFileRules
+	fileTagsChecked sync.Map // reflect.Type → error
+)
+
+type parsedFileRules struct {
+	rules fileRules
+	err   error
+}
+
+// fileRulesOf parses a `file` tag once.
+func fileRulesOf(tag string) (fileRules, error) {
+	if v, ok := fileRulesCache.Load(tag); ok {
+		p := v.(parsedFileRules)
+		return p.rules, p.err
+	}
+	rules, err := parseFileRules(tag)
+	fileRulesCache.Store(tag, parsedFileRules{rules, err})
+	return rules, err
+}
+
+// checkFileTags validates the `file` tags of t and of the types it nests,
+// once per type, so a malformed tag is reported before anything is bound.
+func checkFileTags(t reflect.Type) error {
+	if v, ok := fileTagsChecked.Load(t); ok {
+		if v == nil {
+			return nil
+		}
+		return v.(error)
+	}
+	err := walkFileTags(t, "", map[reflect.Type]bool{})
+	fileTagsChecked.Store(t, err)
+	return err
+}
+
+func walkFileTags(t reflect.Type, path string, seen map[reflect.Type]bool) error {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		if t == fileHeaderType || t == fileHeadersType {
+			return nil
+		}
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := path + field.Name
+		if field.Type == fileHeaderType || field.Type == fileHeadersType {
+			if _, err := fileRulesOf(field.Tag.Get("file")); err != nil {
+				return fmt.Errorf("form: field %s: %w", name, err)
+			}
+			continue
+		}
+		if err := walkFileTags(field.Type, name+".", seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseSize parses sizes such as "512", "100KB", "5MB" or "1GB" (powers of
+// 1024).
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+// bindFile binds the uploaded files of key to a *multipart.FileHeader or
+// []*multipart.FileHeader field, checking the limits of the `file` tag.
+// Types are matched against the content sniffed from the file, never the
+// client's Content-Type or extension, and the sniffed type replaces the
+// header's Content-Type. Violations are recorded with the rule as tag.
+func (b *binder) bindFile(f reflect.Value, key string, tag reflect.StructTag) {
+	files := b.files[key]
+	if len(files) == 0 {
+		return
+	}
+
+	rules, err := fileRulesOf(tag.Get("file"))
+	if err != nil {
+		// Reported by checkFileTags before binding.
+		return
+	}
+
+	single := f.Type() == fileHeaderType
+	if single && len(files) > 1 || rules.maxFiles > 0 && len(files) > rules.maxFiles {
+		max := rules.maxFiles
+		if single {
+			max = 1
+		}
+		b.errs = append(b.errs, &FieldError{
+			Field: key, Tag: "maxfiles", Param: strconv.Itoa(max),
+			Err: fmt.Errorf("at most %d file(s) allowed, got %d", max, len(files)),
+		})
+		return
+	}
+
+	valid := true
+	for i, fh := range files {
+		field := key
+		if !single {
+			field = fmt.Sprintf("%s[%d]", key, i)
+		}
+
+		if rules.maxSize > 0 && fh.Size > rules.maxSize {
+			b.errs = append(b.errs, &FieldError{
+				Field: field, Tag: "maxsize", Param: rules.maxSizeRaw, Value: fh.Filename,
+				Err: fmt.Errorf("%s is larger than %s", fh.Filename, rules.maxSizeRaw),
+			})
+			valid = false
+			continue
+		}
+
+		if len(rules.types) > 0 {
+			contentType, err := sniff(fh)
+			if err != nil {
+				b.errs = append(b.errs, &FieldError{Field: field, Tag: "type", Value: fh.Filename, Err: err})
+				valid = false
+				continue
+			}
+			if !matchType(rules.types, contentType) {
+				b.errs = append(b.errs, &FieldError{
+					Field: field, Tag: "mimetypes", Param: rules.typesRaw, Value: fh.Filename,
+					Err: fmt.Errorf("%s has type %s, allowed: %s", fh.Filename, contentType, strings.Join(rules.types, ", ")),
+				})
+				valid = false
+				continue
+			}
+			fh.Header.Set("Content-Type", contentType)
+		}
+	}
+	if !valid {
+		return
+	}
+
+	if single {
+		f.Set(reflect.ValueOf(files[0]))
+	} else {
+		f.Set(reflect.ValueOf(append([]*multipart.FileHeader(nil), files...)))
+	}
+}
+
+// sniff detects the media type of an upload from its first 512 bytes.
+func sniff(fh *multipart.FileHeader) (string, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", fh.Filename, err)
+	}
+	defer file.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("reading %s: %w", fh.Filename, err)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	if err != nil {
+		return "application/octet-stream", nil
+	}
+	return mediaType, nil
+}
+
+func matchType(allowed []string, contentType string) bool {
+	for _, t := range allowed {
+		if t == contentType || t == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
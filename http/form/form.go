@@ -1,86 +1,90 @@
 package form
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
-	"reflect"
-	"strconv"
 	"strings"
 
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
-	"github.com/socle-lab/pkg/util"
+	pkgvalidator "github.com/socle-lab/pkg/validator"
 )
 
+// MaxMemory is the part of multipart bodies Bind keeps in memory; larger
+// uploads are spooled to temporary files, which net/http removes once the
+// handler returns.
+var MaxMemory int64 = 32 << 20 // 32mb
+
 type FieldTagValidation struct {
-	Field string `json:"field"`
-	Tag   string `json:"tag"`
+	Field   string `json:"field"`
+	Tag     string `json:"tag"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message,omitempty"`
 }
 
+// ExtractValidationErrors lists the failed rules of validator errors and of
+// BindErrors (type errors and upload limits). Fields are named by their
+// json/form path, e.g. "address.city".
 func ExtractValidationErrors(err error) []FieldTagValidation {
+	return TranslateValidationErrors(err, nil, nil)
+}
+
+// TranslateValidationErrors is ExtractValidationErrors with messages rendered
+// by trans (see validator.Translator); target, the validated struct, lets
+// `label` tags name the fields. A nil trans leaves messages empty.
+func TranslateValidationErrors(err error, trans ut.Translator, target any) []FieldTagValidation {
 	var out []FieldTagValidation
 
-	if errs, ok := err.(validator.ValidationErrors); ok {
-		for _, e := range errs {
+	var bindErrs BindErrors
+	if errors.As(err, &bindErrs) {
+		for _, e := range bindErrs {
 			out = append(out, FieldTagValidation{
-				Field: e.Field(),
-				Tag:   e.Tag(),
+				Field:   e.Field,
+				Tag:     e.Tag,
+				Param:   e.Param,
+				Message: e.Err.Error(),
 			})
 		}
+		return out
+	}
+
+	var errs validator.ValidationErrors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			ftv := FieldTagValidation{
+				Field: pkgvalidator.Field(e),
+				Tag:   e.Tag(),
+				Param: e.Param(),
+			}
+			if trans != nil {
+				ftv.Message = pkgvalidator.Message(e, trans, target)
+			}
+			out = append(out, ftv)
+		}
 	}
 
 	return out
 }
 
 func BindForm[T any](r *http.Request, dst *T) error {
+	return Bind(r, dst)
+}
+
+// Bind fills dst, a pointer to a struct, from the request form values (see
+// BindValues) and, for multipart requests, uploaded files (see
+// BindMultipart). Multipart bodies are parsed when they haven't been yet.
+func Bind(r *http.Request, dst any) error {
+	if r.MultipartForm == nil && strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(MaxMemory); err != nil {
+			return err
+		}
+	}
 	if err := r.ParseForm(); err != nil {
 		return err
 	}
 
-	// Use reflection to fill the struct
-	v := reflect.ValueOf(dst).Elem()
-	t := v.Type()
-
-	for i := 0; i < v.NumField(); i++ {
-		field := t.Field(i)
-		formKey := field.Tag.Get("form")
-
-		if formKey == "" {
-			formKey = util.ToSnakeCase(field.Name)
-		}
-
-		value := r.FormValue(formKey)
-		if value == "" {
-			continue
-		}
-
-		f := v.Field(i)
-		if !f.CanSet() {
-			continue
-		}
-
-		switch f.Kind() {
-		case reflect.String:
-			f.SetString(value)
-
-		case reflect.Int, reflect.Int64:
-			n, err := strconv.ParseInt(value, 10, 64)
-			if err != nil {
-				return fmt.Errorf("invalid int for %s: %v", formKey, err)
-			}
-			f.SetInt(n)
-
-		case reflect.Float64:
-			n, err := strconv.ParseFloat(value, 64)
-			if err != nil {
-				return fmt.Errorf("invalid float for %s: %v", formKey, err)
-			}
-			f.SetFloat(n)
-
-		case reflect.Bool:
-			b := value == "1" || strings.ToLower(value) == "true" || value == "on"
-			f.SetBool(b)
-		}
+	if r.MultipartForm != nil {
+		return bind(r.Form, r.MultipartForm.File, dst)
 	}
-
-	return nil
+	return BindValues(r.Form, dst)
 }
@@ -0,0 +1,194 @@
+package form
+
+import (
+	"encoding/json"
+	"maps"
+	"net/url"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/socle-lab/render"
+)
+
+// SensitiveFields are never kept as old input: keys containing one of them
+// are dropped by NewState.
+var SensitiveFields = []string{"password", "csrf_token", "secret"}
+
+// State is what a page needs to be rendered again after a failed submission:
+// the submitted values, the errors of each field and a summary message. It
+// survives a POST-redirect-GET in the session (see Encode).
+type State struct {
+	Values url.Values          `json:"values,omitempty"`
+	Errors map[string][]string `json:"errors,omitempty"`
+	Flash  string              `json:"flash,omitempty"`
+}
+
+// NewState keeps values as old input, minus SensitiveFields.
+func NewState(values url.Values) *State {
+	s := &State{Values: url.Values{}, Errors: map[string][]string{}}
+	for key, vals := range values {
+		if sensitive(key) {
+			continue
+		}
+		s.Values[normalizeKey(key)] = append([]string(nil), vals...)
+	}
+	return s
+}
+
+func sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, f := range SensitiveFields {
+		if strings.Contains(key, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddError records a message for field.
+func (s *State) AddError(field, message string) *State {
+	if s.Errors == nil {
+		s.Errors = map[string][]string{}
+	}
+	field = normalizeKey(field)
+	s.Errors[field] = append(s.Errors[field], message)
+	return s
+}
+
+// AddErrors records the errors of ExtractValidationErrors or
+// TranslateValidationErrors, falling back to the tag without a message.
+func (s *State) AddErrors(errs []FieldTagValidation) *State {
+	for _, e := range errs {
+		message := e.Message
+		if message == "" {
+			message = e.Tag
+		}
+		s.AddError(e.Field, message)
+	}
+	return s
+}
+
+// Valid reports whether no error was recorded.
+func (s *State) Valid() bool {
+	return s == nil || len(s.Errors) == 0
+}
+
+// Old returns the submitted value of field, or "".
+func (s *State) Old(field string) string {
+	if s == nil {
+		return ""
+	}
+	return s.Values.Get(normalizeKey(field))
+}
+
+// OldValues returns all the submitted values of field (checkbox groups,
+// multiple selects).
+func (s *State) OldValues(field string) []string {
+	if s == nil {
+		return nil
+	}
+	return s.Values[normalizeKey(field)]
+}
+
+// Error returns the first error of field, or "".
+func (s *State) Error(field string) string {
+	if errs := s.FieldErrors(field); len(errs) > 0 {
+		return errs[0]
+	}
+	return ""
+}
+
+// FieldErrors returns all the errors of field.
+func (s *State) FieldErrors(field string) []string {
+	if s == nil {
+		return nil
+	}
+	return s.Errors[normalizeKey(field)]
+}
+
+// HasError reports whether field has an error.
+func (s *State) HasError(field string) bool {
+	return len(s.FieldErrors(field)) > 0
+}
+
+// Encode serializes the state for the session.
+func (s *State) Encode() (string, error) {
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+// DecodeState reverses Encode.
+func DecodeState(data string) (*State, error) {
+	s := &State{}
+	if err := json.Unmarshal([]byte(data), s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Funcs are the template helpers of the state: old, oldValues, error,
+// errors, hasError and formFlash.
+func (s *State) Funcs() map[string]any {
+	return map[string]any{
+		"old":       s.Old,
+		"oldValues": s.OldValues,
+		"error":     s.Error,
+		"errors":    s.FieldErrors,
+		"hasError":  s.HasError,
+		"formFlash": func() string {
+			if s == nil {
+				return ""
+			}
+			return s.Flash
+		},
+	}
+}
+
+// PageOptions exposes the state to the page: as Jet variables (old("email"),
+// error("email")...) and as Data["form"] of the template data for other
+// engines ({{ .Data.form.Old "email" }}). They are set on copies, so the
+// caller's VarMap and TemplateData can be shared across requests. Options
+// whose Data or Variables are of another type are left as is.
+func (s *State) PageOptions(opts render.PageOptions) render.PageOptions {
+	if vars, ok := pageVars(opts); ok {
+		for name, fn := range s.Funcs() {
+			vars.Set(name, fn)
+		}
+		vars.Set("form", s)
+		opts.Variables = vars
+	}
+	if td, ok := pageData(opts); ok {
+		td.Data["form"] = s
+		opts.Data = td
+	}
+	return opts
+}
+
+// pageVars returns a copy of the Jet variables of opts, or new ones; ok is
+// false when the variables are of another type.
+func pageVars(opts render.PageOptions) (vars jet.VarMap, ok bool) {
+	switch v := opts.Variables.(type) {
+	case nil:
+		return make(jet.VarMap), true
+	case jet.VarMap:
+		return maps.Clone(v), true
+	}
+	return nil, false
+}
+
+// pageData returns a copy of the template data of opts, with its own Data
+// map, or new data; ok is false when the data is of another type.
+func pageData(opts render.PageOptions) (td *render.TemplateData, ok bool) {
+	switch d := opts.Data.(type) {
+	case nil:
+		return &render.TemplateData{Data: map[string]interface{}{}}, true
+	case *render.TemplateData:
+		cp := *d
+		cp.Data = maps.Clone(d.Data)
+		if cp.Data == nil {
+			cp.Data = map[string]interface{}{}
+		}
+		return &cp, true
+	}
+	return nil, false
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/socle-lab/pkg/apperr"
+	"github.com/socle-lab/pkg/http/form"
+)
+
+// Error writes the response matching err. Domain errors from the apperr
+// package (and problems, validation errors, sql.ErrNoRows) pick their status,
+// message and headers; anything else is a 500 whose details are logged with
+// a stack trace but hidden from the client.
+func (h *Handler) Error(w http.ResponseWriter, r *http.Request, err error) {
+	if err == nil {
+		return
+	}
+
+	var (
+		problem      *Problem
+		decodeErr    *DecodeError
+		bindErrs     form.BindErrors
+		validation   *apperr.ValidationError
+		validateErrs validator.ValidationErrors
+		notFound     *apperr.NotFoundError
+		conflict     *apperr.ConflictError
+		unauthorized *apperr.UnauthorizedError
+		forbidden    *apperr.ForbiddenError
+		rateLimited  *apperr.RateLimitedError
+	)
+
+	var (
+		p      *Problem
+		legacy any
+	)
+	switch {
+	case errors.As(err, &problem):
+		cp := *problem
+		if cp.Status >= http.StatusInternalServerError {
+			h.logInternal(r, cp.Status, err)
+		} else {
+			h.logError(r, cp.Status, err)
+		}
+		h.writeError(w, r, &cp, cp.Error())
+		return
+
+	case errors.As(err, &decodeErr):
+		p = decodeErr.Problem()
+
+	case errors.As(err, &bindErrs):
+		p = NewProblem(http.StatusBadRequest, "invalid form values")
+		for _, fe := range bindErrs {
+			p.WithErrors(FieldIssue{Field: fe.Field, Code: fe.Tag, Param: fe.Param, Message: fe.Err.Error()})
+		}
+		legacy = bindErrs.Error()
+
+	case errors.As(err, &validation):
+		p = NewProblem(http.StatusUnprocessableEntity, validation.Error())
+		if errors.As(validation.Err, &validateErrs) {
+			issues := form.TranslateValidationErrors(validateErrs, h.Translator(r), validation.Target)
+			p.WithErrors(fieldIssues(issues)...)
+			legacy = issues
+		}
+
+	case errors.As(err, &validateErrs):
+		p = NewProblem(http.StatusUnprocessableEntity, "validation failed").
+			WithErrors(fieldIssues(form.TranslateValidationErrors(validateErrs, h.Translator(r), nil))...)
+		legacy = form.ExtractValidationErrors(validateErrs)
+
+	case errors.As(err, &notFound):
+		p = NewProblem(http.StatusNotFound, notFound.Error())
+
+	case errors.Is(err, sql.ErrNoRows):
+		p = NewProblem(http.StatusNotFound, "not found")
+
+	case errors.As(err, &conflict):
+		p = NewProblem(http.StatusConflict, conflict.Error())
+
+	case errors.As(err, &unauthorized):
+		if challenge := unauthorized.Challenge(); challenge != "" {
+			w.Header().Set("WWW-Authenticate", challenge)
+		}
+		p = NewProblem(http.StatusUnauthorized, unauthorized.Error())
+
+	case errors.As(err, &forbidden):
+		p = NewProblem(http.StatusForbidden, forbidden.Error())
+
+	case errors.As(err, &rateLimited):
+		retryAfter := strconv.Itoa(rateLimited.RetryAfterSeconds())
+		w.Header().Set("Retry-After", retryAfter)
+		p = NewProblem(http.StatusTooManyRequests, rateLimited.Error()).With("retry_after", retryAfter)
+
+	default:
+		h.logInternal(r, http.StatusInternalServerError, err)
+		p = NewProblem(http.StatusInternalServerError, "the server encountered a problem")
+		h.writeError(w, r, p, p.Detail)
+		return
+	}
+
+	h.logError(r, p.Status, err)
+	p.WithCause(err)
+	if legacy == nil {
+		legacy = p.Detail
+	}
+	h.writeError(w, r, p, legacy)
+}
+
+// logInternal logs a server error with its cause chain and stack.
+func (h *Handler) logInternal(r *http.Request, status int, err error) {
+	stack := apperr.StackTrace(err)
+	if stack == "" {
+		stack = string(debug.Stack())
+	}
+	h.Slog().ErrorContext(r.Context(), "request failed",
+		"method", r.Method, "path", r.URL.Path, "status", status, "error", err, "stack", stack)
+}
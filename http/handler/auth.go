@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/socle-lab/pkg/apperr"
+	"github.com/socle-lab/pkg/auth"
+	"github.com/socle-lab/pkg/ui/grid"
+)
+
+// Principal returns the principal authenticated by the auth middleware, or
+// nil for anonymous requests.
+func (h *Handler) Principal(r *http.Request) *auth.Principal {
+	return auth.FromContext(r.Context())
+}
+
+// IsAuthenticated reports whether the request has a principal.
+func (h *Handler) IsAuthenticated(r *http.Request) bool {
+	return auth.FromContext(r.Context()) != nil
+}
+
+// UserID returns the ID of the principal, or "".
+func (h *Handler) UserID(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return p.ID
+	}
+	return ""
+}
+
+// CurrentUser returns the application user loaded by the authenticator, or
+// nil. Use auth.User for a typed value.
+func (h *Handler) CurrentUser(r *http.Request) any {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return p.User
+	}
+	return nil
+}
+
+// Can reports whether the principal holds permission on resource (nil for
+// none) under h.Policy. Without Policy, nothing is allowed.
+func (h *Handler) Can(r *http.Request, permission string, resource any) bool {
+	return h.Policy != nil && auth.Can(r.Context(), h.Policy, permission, resource)
+}
+
+// Authorize returns an error for h.Error when the principal does not hold
+// permission on resource: unauthorized for anonymous requests, forbidden
+// otherwise.
+func (h *Handler) Authorize(r *http.Request, permission string, resource any) error {
+	if h.Can(r, permission, resource) {
+		return nil
+	}
+	if !h.IsAuthenticated(r) {
+		return apperr.Unauthorized("authentication required")
+	}
+	return apperr.Forbidden("you are not allowed to " + permission)
+}
+
+// AuthorizeGrid returns g with the actions and navbar items the principal
+// may not use removed, or disabled with grid.DeniedDisable.
+func (h *Handler) AuthorizeGrid(r *http.Request, g grid.Grid, mode grid.DeniedMode) grid.Grid {
+	return g.Authorized(func(permission string) bool {
+		return h.Can(r, permission, nil)
+	}, mode)
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag returns the strong entity tag of body.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified sets the validators of the resource (etag and modified may be
+// empty) and, when the request's If-None-Match or If-Modified-Since shows
+// the client's copy is current, answers 304 and returns true. Handlers can
+// call it before loading an expensive resource whose version they know.
+func (h *Handler) NotModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if !fresh(r, w.Header()) {
+		return false
+	}
+	writeNotModified(w)
+	return true
+}
+
+// fresh reports whether the conditional headers of a GET or HEAD request
+// match the validators in header. If-None-Match takes precedence over
+// If-Modified-Since (RFC 9110, 13.2.2).
+func fresh(r *http.Request, header http.Header) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := header.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// Weak comparison, as required for If-None-Match.
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(ims)
+}
+
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// writeResponse writes a successful response body, with a strong ETag when
+// h.ETags is set, or a 304 when the client's copy is current (see
+// NotModified; a Last-Modified header set by the handler is honoured too).
+func (h *Handler) writeResponse(w http.ResponseWriter, r *http.Request, status int, contentType string, body []byte) error {
+	if status == http.StatusOK && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		w.Header().Set("Content-Type", contentType)
+		if h.ETags {
+			w.Header().Set("ETag", ETag(body))
+		}
+		if fresh(r, w.Header()) {
+			writeNotModified(w)
+			return nil
+		}
+	}
+	return writeBody(w, status, contentType, body)
+}
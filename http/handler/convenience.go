@@ -2,28 +2,51 @@ package handler
 
 import (
 	"context"
+	"log/slog"
 	"net/http"
 
 	"github.com/socle-lab/core"
+	"github.com/socle-lab/pkg/http/form"
+	"github.com/socle-lab/pkg/logging"
 	"github.com/socle-lab/render"
 )
 
 func (h *Handler) Render(w http.ResponseWriter, r *http.Request, opts render.PageOptions) error {
-	return h.Core.Render.Page(w, r, opts)
+	return h.Core.Render.Page(w, r, form.CSRFPageOptions(r.Context(), opts))
 }
 
-func (h *Handler) Log(tag string, args ...any) {
-	switch tag {
-	case "info":
-		h.Core.Log.InfoLog.Println(args...)
+// RenderForm renders the view of a form: it pops the pending form state, if
+// any, and exposes it to the template with the old and error helpers (see
+// form.State.PageOptions). Use it for the page RedirectWithFormState
+// redirects to.
+func (h *Handler) RenderForm(w http.ResponseWriter, r *http.Request, opts render.PageOptions) error {
+	state := h.PopFormState(r.Context())
+	if state == nil {
+		state = &form.State{}
+	}
+	return h.Core.Render.Page(w, r, form.CSRFPageOptions(r.Context(), state.PageOptions(opts)))
+}
 
-	default:
-		h.Core.Log.ErrorLog.Println(args...)
+// Slog returns Logger, or an adapter of the info and error loggers of Core.
+// Log with the request context (InfoContext...) to get the request ID, user
+// and route.
+func (h *Handler) Slog() *slog.Logger {
+	if h.Logger != nil {
+		return h.Logger
 	}
+	return logging.Std(h.Core.Log.InfoLog, h.Core.Log.ErrorLog)
+}
+
+// Log logs args to the info log for the "info" tag, to the error log for any
+// other.
+func (h *Handler) Log(tag string, args ...any) {
+	logging.Log(context.Background(), h.Slog(), tag, slog.LevelError, args...)
 }
 
+// PutSession stores val in the session. Only the key is logged, at debug
+// level: session values routinely hold credentials.
 func (h *Handler) PutSession(ctx context.Context, key string, val interface{}) {
-	h.Core.Log.InfoLog.Printf("Putting session data: %v", val)
+	h.Slog().DebugContext(ctx, "putting session data", "key", key)
 	h.Core.Session.Put(ctx, key, val)
 }
 
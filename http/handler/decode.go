@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/socle-lab/pkg/apperr"
+	"github.com/socle-lab/pkg/http/form"
+	"github.com/socle-lab/pkg/validator"
+)
+
+const (
+	defaultMaxBodyBytes   = 1_048_576 // 1mb
+	defaultMaxUploadBytes = 32 << 20  // 32mb
+)
+
+// DecodeError reports a request body that could not be decoded. Status is
+// 400 (malformed body), 413 (too large) or 415 (unsupported content type).
+type DecodeError struct {
+	Status  int
+	Message string
+	Field   string // offending field, when known
+	Offset  int64  // byte offset in the body, when known
+	Err     error
+}
+
+func (e *DecodeError) Error() string { return e.Message }
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// Problem converts the error into a problem document.
+func (e *DecodeError) Problem() *Problem {
+	p := NewProblem(e.Status, e.Message).WithCause(e.Err)
+	if e.Field != "" {
+		p.With("field", e.Field)
+	}
+	if e.Offset > 0 {
+		p.With("offset", e.Offset)
+	}
+	return p
+}
+
+func (h *Handler) maxBodyBytes() int64 {
+	if h.MaxBodyBytes > 0 {
+		return h.MaxBodyBytes
+	}
+	return defaultMaxBodyBytes
+}
+
+func (h *Handler) maxUploadBytes() int64 {
+	if h.MaxUploadBytes > 0 {
+		return h.MaxUploadBytes
+	}
+	return defaultMaxUploadBytes
+}
+
+// Decode reads the request body into dst according to its Content-Type
+// (JSON by default, XML, form-urlencoded or multipart, uploads included),
+// then validates dst with validator.Check.
+//
+// It returns a *DecodeError for unreadable bodies, form.BindErrors for form
+// values of the wrong type and an *apperr.ValidationError for invalid
+// values; all are mapped by h.Error.
+// Unknown JSON fields are rejected; form bodies may carry extra fields (CSRF
+// token, submit buttons) and XML ignores unknown elements.
+func (h *Handler) Decode(w http.ResponseWriter, r *http.Request, dst any) error {
+	mediaType := "application/json"
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return &DecodeError{Status: http.StatusUnsupportedMediaType, Message: "invalid Content-Type header", Err: err}
+		}
+		mediaType = mt
+	}
+
+	max := h.maxBodyBytes()
+	if mediaType == "multipart/form-data" {
+		max = h.maxUploadBytes()
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, max)
+
+	var err error
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		err = decodeJSON(r.Body, dst, max)
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		err = decodeXML(r.Body, dst, max)
+	case mediaType == "application/x-www-form-urlencoded":
+		err = decodeForm(r, dst, max, false)
+	case mediaType == "multipart/form-data":
+		err = decodeForm(r, dst, max, true)
+	default:
+		return &DecodeError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("unsupported Content-Type %q", mediaType),
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if isStructPtr(dst) {
+		if err := validator.Check(r.Context(), dst); err != nil {
+			if !validator.IsValidationError(err) {
+				return err
+			}
+			return &apperr.ValidationError{Target: dst, Err: err}
+		}
+	}
+	return nil
+}
+
+func isStructPtr(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Struct
+}
+
+func tooLarge(max int64, err error) *DecodeError {
+	return &DecodeError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Message: fmt.Sprintf("body must not be larger than %d bytes", max),
+		Err:     err,
+	}
+}
+
+func badRequest(err error, format string, args ...any) *DecodeError {
+	return &DecodeError{Status: http.StatusBadRequest, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+func decodeJSON(body io.Reader, dst any, max int64) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		var (
+			syntaxErr    *json.SyntaxError
+			typeErr      *json.UnmarshalTypeError
+			maxBytesErr  *http.MaxBytesError
+			unmarshalErr *json.InvalidUnmarshalError
+		)
+
+		switch {
+		case errors.As(err, &syntaxErr):
+			e := badRequest(err, "body contains badly-formed JSON (at byte %d)", syntaxErr.Offset)
+			e.Offset = syntaxErr.Offset
+			return e
+
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return badRequest(err, "body contains badly-formed JSON")
+
+		case errors.As(err, &typeErr):
+			if typeErr.Field != "" {
+				e := badRequest(err, "body contains incorrect JSON type for field %q: got %s, expected %s (at byte %d)",
+					typeErr.Field, typeErr.Value, typeErr.Type, typeErr.Offset)
+				e.Field = typeErr.Field
+				e.Offset = typeErr.Offset
+				return e
+			}
+			e := badRequest(err, "body contains incorrect JSON type: got %s, expected %s (at byte %d)",
+				typeErr.Value, typeErr.Type, typeErr.Offset)
+			e.Offset = typeErr.Offset
+			return e
+
+		case errors.Is(err, io.EOF):
+			return badRequest(err, "body must not be empty")
+
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			// encoding/json has no typed error for this case.
+			field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+			e := badRequest(err, "body contains unknown field %q (at byte %d)", field, dec.InputOffset())
+			e.Field = field
+			e.Offset = dec.InputOffset()
+			return e
+
+		case errors.As(err, &maxBytesErr):
+			return tooLarge(max, err)
+
+		case errors.As(err, &unmarshalErr):
+			// Programming error: dst is not a pointer.
+			return err
+
+		default:
+			return badRequest(err, "%s", err.Error())
+		}
+	}
+
+	offset := dec.InputOffset()
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return tooLarge(max, err)
+		}
+		e := badRequest(err, "body must only contain a single JSON value (trailing data at byte %d)", offset)
+		e.Offset = offset
+		return e
+	}
+	return nil
+}
+
+func decodeXML(body io.Reader, dst any, max int64) error {
+	dec := xml.NewDecoder(body)
+
+	if err := dec.Decode(dst); err != nil {
+		var (
+			syntaxErr   *xml.SyntaxError
+			maxBytesErr *http.MaxBytesError
+		)
+		switch {
+		case errors.As(err, &maxBytesErr):
+			return tooLarge(max, err)
+		case errors.Is(err, io.EOF):
+			return badRequest(err, "body must not be empty")
+		case errors.As(err, &syntaxErr):
+			e := badRequest(err, "body contains badly-formed XML (line %d, at byte %d): %s",
+				syntaxErr.Line, dec.InputOffset(), syntaxErr.Msg)
+			e.Offset = dec.InputOffset()
+			return e
+		default:
+			// Type mismatches surface as strconv errors without a field name.
+			e := badRequest(err, "body contains invalid XML value (at byte %d): %v", dec.InputOffset(), err)
+			e.Offset = dec.InputOffset()
+			return e
+		}
+	}
+
+	// Only whitespace, comments and processing instructions may follow.
+	offset := dec.InputOffset()
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return tooLarge(max, err)
+		}
+		if err != nil {
+			e := badRequest(err, "body contains badly-formed XML after the document (at byte %d)", offset)
+			e.Offset = offset
+			return e
+		}
+		switch t := tok.(type) {
+		case xml.Comment, xml.ProcInst:
+			continue
+		case xml.CharData:
+			if len(strings.TrimSpace(string(t))) == 0 {
+				continue
+			}
+		}
+		e := badRequest(nil, "body must only contain a single XML document (trailing data at byte %d)", offset)
+		e.Offset = offset
+		return e
+	}
+}
+
+// ParseForm parses a form-urlencoded or multipart body within the limits of
+// Decode (MaxBodyBytes, MaxUploadBytes, form.MaxMemory), for code that reads
+// form values before the handler, such as the CSRF middleware. Errors are
+// *DecodeError; other bodies are left unread.
+func (h *Handler) ParseForm(w http.ResponseWriter, r *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		max := h.maxBodyBytes()
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		return parseForm(r, max, false)
+	case "multipart/form-data":
+		max := h.maxUploadBytes()
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		return parseForm(r, max, true)
+	}
+	return nil
+}
+
+func parseForm(r *http.Request, max int64, multipart bool) error {
+	var err error
+	if multipart {
+		err = r.ParseMultipartForm(form.MaxMemory)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return tooLarge(max, err)
+		}
+		return badRequest(err, "body contains badly-formed form data: %v", err)
+	}
+	return nil
+}
+
+func decodeForm(r *http.Request, dst any, max int64, multipart bool) error {
+	if err := parseForm(r, max, multipart); err != nil {
+		return err
+	}
+
+	if err := form.Bind(r, dst); err != nil {
+		var bindErrs form.BindErrors
+		if errors.As(err, &bindErrs) {
+			return bindErrs
+		}
+		return badRequest(err, "%s", err.Error())
+	}
+	return nil
+}
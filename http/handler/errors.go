@@ -1,93 +1,223 @@
 package handler
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"html"
 	"net/http"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/socle-lab/pkg/http/form"
+	"github.com/socle-lab/render"
 )
 
 func (h *Handler) ErrorResponse(w http.ResponseWriter, r *http.Request, err any, status int) {
-	//h.logger.Errorw("internal error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	h.Core.Log.ErrorLog.Println(err)
-	writeError(h.Core.App.Type, w, status, err)
+	h.logError(r, status, err)
+	h.writeError(w, r, h.problemFor(r, status, err), err)
 }
 
 func (h *Handler) InternalServerErrorResponse(w http.ResponseWriter, r *http.Request, err any) {
-	//h.logger.Errorw("internal error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	h.Core.Log.ErrorLog.Println(err)
-	writeError(h.Core.App.Type, w, http.StatusInternalServerError, errors.New("the server encountered a problem"))
+	h.logError(r, http.StatusInternalServerError, err)
+	p := NewProblem(http.StatusInternalServerError, "the server encountered a problem")
+	if cause, ok := err.(error); ok {
+		p.WithCause(cause)
+	}
+	h.writeError(w, r, p, p.Detail)
 }
 
 func (h *Handler) UnprocessableEntityResponse(w http.ResponseWriter, r *http.Request, err any) {
-	//h.logger.Errorw("internal error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	h.Core.Log.ErrorLog.Println(err)
-	writeError(h.Core.App.Type, w, http.StatusUnprocessableEntity, err)
+	h.logError(r, http.StatusUnprocessableEntity, err)
+	h.writeError(w, r, h.problemFor(r, http.StatusUnprocessableEntity, err), err)
 }
 
 func (h *Handler) MethodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
-	//h.logger.Errorw("internal error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	writeError(h.Core.App.Type, w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+	p := NewProblem(http.StatusMethodNotAllowed, "Method not allowed")
+	h.writeError(w, r, p, p.Detail)
 }
 
 func (h *Handler) ForbiddenResponse(w http.ResponseWriter, r *http.Request) {
-	//h.logger.Warnw("forbidden", "method", r.Method, "path", r.URL.Path, "error")
-	writeError(h.Core.App.Type, w, http.StatusForbidden, errors.New("forbidden"))
+	p := NewProblem(http.StatusForbidden, "forbidden")
+	h.writeError(w, r, p, p.Detail)
 }
 
 func (h *Handler) BadRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	//h.logger.Warnf("bad request", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	h.Core.Log.ErrorLog.Println(err)
-	writeError(h.Core.App.Type, w, http.StatusBadRequest, err)
+	h.logError(r, http.StatusBadRequest, err)
+	h.writeError(w, r, h.problemFor(r, http.StatusBadRequest, err), err)
 }
 
 func (h *Handler) ConflictResponse(w http.ResponseWriter, r *http.Request, err error) {
-	//h.logger.Errorf("conflict response", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	h.Core.Log.ErrorLog.Println(err)
-	writeError(h.Core.App.Type, w, http.StatusConflict, err)
+	h.logError(r, http.StatusConflict, err)
+	h.writeError(w, r, h.problemFor(r, http.StatusConflict, err), err)
 }
 
 func (h *Handler) NotFoundResponse(w http.ResponseWriter, r *http.Request, err error) {
-	//h.logger.Warnf("not found error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	h.Core.Log.ErrorLog.Println(err)
-	writeError(h.Core.App.Type, w, http.StatusNotFound, errors.New("not found"))
+	h.logError(r, http.StatusNotFound, err)
+	p := NewProblem(http.StatusNotFound, "not found").WithCause(err)
+	h.writeError(w, r, p, p.Detail)
 }
 
 func (h *Handler) UnauthorizedErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
-	//h.logger.Warnf("unauthorized error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	h.Core.Log.ErrorLog.Println(err)
-	writeError(h.Core.App.Type, w, http.StatusUnauthorized, errors.New("unauthorized"))
+	h.logError(r, http.StatusUnauthorized, err)
+	p := NewProblem(http.StatusUnauthorized, "unauthorized").WithCause(err)
+	h.writeError(w, r, p, p.Detail)
 }
 
 func (h *Handler) UnauthorizedBasicErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
-	//h.logger.Warnf("unauthorized basic error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	h.Core.Log.ErrorLog.Println(err)
+	h.logError(r, http.StatusUnauthorized, err)
 	w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
 
-	writeError(h.Core.App.Type, w, http.StatusUnauthorized, errors.New("unauthorized"))
+	p := NewProblem(http.StatusUnauthorized, "unauthorized").WithCause(err)
+	h.writeError(w, r, p, p.Detail)
 }
 
 func (h *Handler) TooManyRequestsResponse(w http.ResponseWriter, r *http.Request, retryAfter string) {
-	//h.logger.Warnw("rate limit exceeded", "method", r.Method, "path", r.URL.Path)
-	h.Core.Log.ErrorLog.Println(retryAfter)
+	h.logError(r, http.StatusTooManyRequests, "rate limit exceeded, retry after: "+retryAfter)
 	w.Header().Set("Retry-After", retryAfter)
 
-	writeError(h.Core.App.Type, w, http.StatusTooManyRequests, errors.New("rate limit exceeded, retry after: "+retryAfter))
+	p := NewProblem(http.StatusTooManyRequests, "rate limit exceeded, retry after: "+retryAfter).
+		With("retry_after", retryAfter)
+	h.writeError(w, r, p, p.Detail)
+}
+
+// ProblemResponse writes a problem built by the caller.
+func (h *Handler) ProblemResponse(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Status >= http.StatusInternalServerError {
+		h.logError(r, p.Status, p)
+	}
+	h.writeError(w, r, p, p.Error())
 }
 
-func writeError(moduleType string, w http.ResponseWriter, statusCode int, err any) {
+// logError logs the error with its request and, when it carries one, the
+// underlying cause.
+func (h *Handler) logError(r *http.Request, status int, err any) {
+	args := []any{"method", r.Method, "path", r.URL.Path, "status", status, "error", err}
+	var p *Problem
+	if e, ok := err.(error); ok && errors.As(e, &p) && p.cause != nil {
+		args = append(args, "cause", p.cause)
+	}
+	h.Slog().ErrorContext(r.Context(), "request failed", args...)
+}
 
-	if moduleType == "web" {
-		if err, ok := err.(error); ok {
-			http.Error(w, err.Error(), statusCode)
-		} else {
-			writeHTML(w, statusCode, fmt.Sprintf("%v", err))
+// writeError completes p with the request details and writes it in the
+// representation negotiated from the Accept header: problem documents in JSON
+// or XML, an HTML page (ErrorView when set) or plain text.
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, p *Problem, legacy any) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = requestID(r)
+	}
+	if err, ok := legacy.(error); ok {
+		legacy = err.Error()
+	}
+
+	w.Header().Add("Vary", "Accept")
+	mediaType := h.Negotiate(r, MediaProblemJSON, MediaJSON, MediaProblemXML, MediaXML, MediaHTML, MediaText)
+	if mediaType == "" {
+		mediaType = h.Fallback(r)
+	}
+
+	switch mediaType {
+	case MediaHTML:
+		h.writeErrorPage(w, r, p)
+	case MediaText:
+		writeProblemText(w, p, legacy)
+	case MediaXML, MediaProblemXML:
+		writeProblemXML(w, p)
+	default:
+		writeProblem(w, h.ErrorFormat, p, legacy, accepts(r, MediaProblemJSON))
+	}
+}
+
+// writeErrorPage renders ErrorView, the problem being Data["problem"] of the
+// template data, or a minimal page when no view is configured or rendering
+// fails.
+func (h *Handler) writeErrorPage(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if h.ErrorView != "" && h.Core != nil && h.Core.Render != nil {
+		var buf bytes.Buffer
+		rec := &bufferedWriter{header: w.Header(), body: &buf}
+		err := h.Core.Render.Page(rec, r, render.PageOptions{
+			View: h.ErrorView,
+			Data: &render.TemplateData{Error: p.Error(), Data: map[string]interface{}{"problem": p}},
+		})
+		if err == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(p.Status)
+			w.Write(buf.Bytes())
+			return
 		}
-	} else {
-		if err, ok := err.(error); ok {
-			writeJSONError(w, statusCode, err.Error())
-		} else {
-			writeJSON(w, statusCode, err)
+		h.Slog().ErrorContext(r.Context(), "rendering error view", "view", h.ErrorView, "error", err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<!doctype html>\n<title>%d %s</title>\n<h1>%s</h1>\n",
+		p.Status, html.EscapeString(p.Title), html.EscapeString(p.Title))
+	if p.Detail != "" {
+		fmt.Fprintf(&sb, "<p>%s</p>\n", html.EscapeString(p.Detail))
+	}
+	if len(p.Errors) > 0 {
+		sb.WriteString("<ul>\n")
+		for _, issue := range p.Errors {
+			fmt.Fprintf(&sb, "<li>%s: %s</li>\n", html.EscapeString(issue.Field), html.EscapeString(issue.text()))
+		}
+		sb.WriteString("</ul>\n")
+	}
+	writeHTML(w, p.Status, sb.String())
+}
+
+// bufferedWriter collects a rendered page so a failed render doesn't leave
+// a half written response.
+type bufferedWriter struct {
+	header http.Header
+	body   *bytes.Buffer
+}
+
+func (b *bufferedWriter) Header() http.Header         { return b.header }
+func (b *bufferedWriter) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedWriter) WriteHeader(int)             {}
+
+// problemFor converts the values accepted by the error helpers into a
+// problem: problems are kept, validation errors become field issues and
+// other errors become the detail.
+func (h *Handler) problemFor(r *http.Request, status int, err any) *Problem {
+	switch v := err.(type) {
+	case nil:
+		return NewProblem(status, "")
+
+	case []form.FieldTagValidation:
+		return NewProblem(status, "validation failed").WithErrors(fieldIssues(v)...)
+
+	case validator.ValidationErrors:
+		return NewProblem(status, "validation failed").
+			WithErrors(fieldIssues(form.TranslateValidationErrors(v, h.Translator(r), nil))...).
+			WithCause(v)
+
+	case error:
+		var p *Problem
+		if errors.As(v, &p) {
+			cp := *p
+			if cp.Status == 0 {
+				cp.Status = status
+			}
+			return &cp
 		}
+		return NewProblem(status, v.Error()).WithCause(v)
+
+	case string:
+		return NewProblem(status, v)
+
+	default:
+		return NewProblem(status, fmt.Sprintf("%v", v))
+	}
+}
 
+func fieldIssues(in []form.FieldTagValidation) []FieldIssue {
+	out := make([]FieldIssue, len(in))
+	for i, f := range in {
+		out[i] = FieldIssue{Field: f.Field, Code: f.Tag, Param: f.Param, Message: f.Message}
 	}
+	return out
 }
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/socle-lab/pkg/apperr"
+	"github.com/socle-lab/pkg/http/form"
+)
+
+// FormStateSessionKey is the session key of the pending form state.
+const FormStateSessionKey = "form_state"
+
+var formSummaries = map[string]string{
+	"en": "Please correct the highlighted fields.",
+	"fr": "Veuillez corriger les champs signalés.",
+}
+
+// NewFormState builds the state of a failed submission: the request's form
+// values and, when err comes from Decode, form.Bind or the validator, its
+// field errors translated for the request, with a summary flash.
+func (h *Handler) NewFormState(r *http.Request, err error) *form.State {
+	s := form.NewState(r.PostForm)
+	if len(r.PostForm) == 0 {
+		s = form.NewState(r.Form)
+	}
+	if err == nil {
+		return s
+	}
+
+	var (
+		target     any
+		validation *apperr.ValidationError
+	)
+	if errors.As(err, &validation) {
+		target = validation.Target
+	}
+	s.AddErrors(form.TranslateValidationErrors(err, h.Translator(r), target))
+
+	s.Flash = formSummaries[h.Locale(r)]
+	if s.Valid() {
+		// Not a field error: show it as the summary.
+		s.Flash = err.Error()
+	}
+	return s
+}
+
+// PutFormState stores s in the session for the page rendered after the
+// redirect.
+func (h *Handler) PutFormState(ctx context.Context, s *form.State) error {
+	data, err := s.Encode()
+	if err != nil {
+		return err
+	}
+	h.Core.Session.Put(ctx, FormStateSessionKey, data)
+	return nil
+}
+
+// PopFormState returns the pending form state and removes it from the
+// session, or nil when there is none.
+func (h *Handler) PopFormState(ctx context.Context) *form.State {
+	if !h.sessionLoaded(ctx) {
+		return nil
+	}
+
+	data := h.Core.Session.PopString(ctx, FormStateSessionKey)
+	if data == "" {
+		return nil
+	}
+	s, err := form.DecodeState(data)
+	if err != nil {
+		h.Slog().ErrorContext(ctx, "decoding form state", "error", err)
+		return nil
+	}
+	return s
+}
+
+// RedirectWithFormState stores the state of the failed submission (see
+// NewFormState) and redirects to url with 303 See Other; render the target
+// page with RenderForm.
+func (h *Handler) RedirectWithFormState(w http.ResponseWriter, r *http.Request, url string, err error) {
+	if err := h.PutFormState(r.Context(), h.NewFormState(r, err)); err != nil {
+		h.Error(w, r, err)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
@@ -1,10 +1,37 @@
 package handler
 
 import (
+	"log/slog"
+
 	"github.com/socle-lab/core"
+	"github.com/socle-lab/pkg/auth"
 )
 
 // Handlers is the type for handlers, and gives access to Socle and models
 type Handler struct {
 	Core *core.Core
+	// ErrorFormat selects the body of error responses (see ErrorFormat).
+	ErrorFormat ErrorFormat
+	// ErrorView, when set, is the view rendered for errors negotiated as
+	// HTML; the *Problem is Data["problem"] of its template data.
+	ErrorView string
+	// MaxBodyBytes bounds the bodies read by Decode (default 1mb).
+	MaxBodyBytes int64
+	// MaxUploadBytes bounds multipart bodies instead (default 32mb); the
+	// part beyond form.MaxMemory is spooled to temporary files.
+	MaxUploadBytes int64
+	// Policy decides the permissions checked by Can, Authorize and
+	// AuthorizeGrid.
+	Policy auth.Policy
+	// ETags adds strong ETags to the responses of Respond, OKFor and JsonFor
+	// and answers If-None-Match with 304s; OK and Json, which don't see the
+	// request, can't.
+	ETags bool
+	// XML offers XML to the clients of Respond, for values xml.Marshal can
+	// encode (not maps). It is off by default: browsers rank application/xml
+	// above */*.
+	XML bool
+	// Logger receives the logs of the handler and its middlewares (see the
+	// logging package). Defaults to the info and error loggers of Core.
+	Logger *slog.Logger
 }
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/socle-lab/pkg/csv/jobs"
+)
+
+// ImportJobUpload queues the file posted in the "file" multipart field for
+// the named importer and answers 202 with the job. The body is bounded by
+// MaxUploadBytes; an upload of unknown format is a 422.
+func (h *Handler) ImportJobUpload(m *jobs.Manager, importer string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		max := h.maxUploadBytes()
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		if err := parseForm(r, max, true); err != nil {
+			h.Error(w, r, err)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			h.BadRequestResponse(w, r, err)
+			return
+		}
+		defer file.Close()
+
+		job, err := m.Submit(r.Context(), importer, header.Filename, header.Header.Get("Content-Type"), file)
+		if errors.Is(err, jobs.ErrUnsupportedFormat) {
+			h.UnprocessableEntityResponse(w, r, err)
+			return
+		}
+		if err != nil {
+			h.InternalServerErrorResponse(w, r, err)
+			return
+		}
+
+		w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+job.ID)
+		h.Respond(w, r, http.StatusAccepted, job)
+	}
+}
+
+// ImportJobStatus returns the job identified by the {id} route parameter,
+// for status polling.
+func (h *Handler) ImportJobStatus(m *jobs.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, err := m.Get(r.Context(), chi.URLParam(r, "id"))
+		if errors.Is(err, jobs.ErrNotFound) {
+			h.NotFoundResponse(w, r, err)
+			return
+		}
+		if err != nil {
+			h.InternalServerErrorResponse(w, r, err)
+			return
+		}
+
+		if !job.Done() {
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("Retry-After", strconv.Itoa(2))
+		}
+		h.OKFor(w, r, job)
+	}
+}
+
+// ImportJobList returns the most recent jobs, bounded by the "limit" query
+// parameter (default 50).
+func (h *Handler) ImportJobList(m *jobs.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 50
+		if v := r.URL.Query().Get("limit"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 500 {
+				limit = n
+			}
+		}
+
+		list, err := m.List(r.Context(), limit)
+		if err != nil {
+			h.InternalServerErrorResponse(w, r, err)
+			return
+		}
+		h.OKFor(w, r, list)
+	}
+}
+
+// ImportJobErrorReport downloads the CSV of rejected rows of the {id} job.
+func (h *Handler) ImportJobErrorReport(m *jobs.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		report, err := m.ErrorReport(r.Context(), id)
+		if errors.Is(err, jobs.ErrNotFound) {
+			h.NotFoundResponse(w, r, err)
+			return
+		}
+		if err != nil {
+			h.InternalServerErrorResponse(w, r, err)
+			return
+		}
+		defer report.Close()
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+id+`-errors.csv"`)
+		w.WriteHeader(http.StatusOK)
+		io.Copy(w, report)
+	}
+}
+
+// ImportJobRoutes mounts the endpoints above on a router:
+//
+//	POST /            upload
+//	GET  /            list
+//	GET  /{id}        status
+//	GET  /{id}/errors error report
+//	GET  /{id}/events progress events (SSE)
+func (h *Handler) ImportJobRoutes(m *jobs.Manager, importer string) http.Handler {
+	r := chi.NewRouter()
+	r.Post("/", h.ImportJobUpload(m, importer))
+	r.Get("/", h.ImportJobList(m))
+	r.Get("/{id}", h.ImportJobStatus(m))
+	r.Get("/{id}/errors", h.ImportJobErrorReport(m))
+	r.Get("/{id}/events", h.ImportJobEvents(m))
+	return r
+}
+
+// ImportJobEvents streams the progress of the {id} job as Server-Sent
+// Events: a "progress" event whenever the job changes, then a "done" event
+// once it has finished. Event IDs let reconnecting clients skip a state they
+// already have.
+func (h *Handler) ImportJobEvents(m *jobs.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		job, err := m.Get(r.Context(), id)
+		if errors.Is(err, jobs.ErrNotFound) {
+			h.NotFoundResponse(w, r, err)
+			return
+		}
+		if err != nil {
+			h.InternalServerErrorResponse(w, r, err)
+			return
+		}
+
+		s, err := h.SSE(w, r)
+		if err != nil {
+			h.InternalServerErrorResponse(w, r, err)
+			return
+		}
+		defer s.Heartbeat(15 * time.Second)()
+
+		last := s.LastEventID()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			version := strconv.FormatInt(job.UpdatedAt.UnixNano(), 10)
+			if version != last {
+				if err := s.Send(Event{ID: version, Event: "progress", Data: job}); err != nil {
+					return
+				}
+				last = version
+			}
+			if job.Done() {
+				s.Send(Event{Event: "done", Data: job})
+				return
+			}
+
+			select {
+			case <-s.Done():
+				return
+			case <-ticker.C:
+			}
+			if job, err = m.Get(r.Context(), id); err != nil {
+				s.Send(Event{Event: "error", Data: map[string]string{"error": "the job could not be read"}})
+				h.Slog().ErrorContext(r.Context(), "reading import job", "method", r.Method, "path", r.URL.Path, "job", id, "error", err)
+				return
+			}
+		}
+	}
+}
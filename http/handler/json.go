@@ -12,13 +12,8 @@ func writeJSON(w http.ResponseWriter, status int, data any) error {
 }
 
 func readJSON(w http.ResponseWriter, r *http.Request, data any) error {
-	maxBytes := 1_048_578 // 1mb
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
-
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields()
-
-	return decoder.Decode(data)
+	r.Body = http.MaxBytesReader(w, r.Body, defaultMaxBodyBytes)
+	return decodeJSON(r.Body, data, defaultMaxBodyBytes)
 }
 
 func writeJSONError(w http.ResponseWriter, status int, message string) error {
@@ -29,6 +24,8 @@ func writeJSONError(w http.ResponseWriter, status int, message string) error {
 	return writeJSON(w, status, &envelope{Error: message})
 }
 
+// Json writes data in a JSON envelope. It doesn't see the request, so it
+// ignores h.ETags and conditional requests: use JsonFor for those.
 func (h *Handler) Json(w http.ResponseWriter, status int, data any) error {
 	type envelope struct {
 		Data any `json:"data"`
@@ -36,3 +33,17 @@ func (h *Handler) Json(w http.ResponseWriter, status int, data any) error {
 
 	return writeJSON(w, status, &envelope{Data: data})
 }
+
+// JsonFor writes the body of Json, with an ETag when h.ETags is set and a
+// 304 when the client's copy is current.
+func (h *Handler) JsonFor(w http.ResponseWriter, r *http.Request, status int, data any) error {
+	type envelope struct {
+		Data any `json:"data"`
+	}
+
+	body, err := json.Marshal(&envelope{Data: data})
+	if err != nil {
+		return err
+	}
+	return h.writeResponse(w, r, status, "application/json", append(body, '\n'))
+}
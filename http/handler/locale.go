@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/socle-lab/pkg/validator"
+)
+
+// LocaleSessionKey is the session key holding the user's chosen locale.
+const LocaleSessionKey = "locale"
+
+// Locale returns the locale of the request: the one stored in the session,
+// else the Accept-Language header, else validator.DefaultLocale.
+func (h *Handler) Locale(r *http.Request) string {
+	return h.Translator(r).Locale()
+}
+
+// Translator returns the validation message translator for the request's
+// locale (see Locale).
+func (h *Handler) Translator(r *http.Request) ut.Translator {
+	return validator.Translator(h.sessionLocale(r.Context()), r.Header.Get("Accept-Language"))
+}
+
+// sessionLocale reads the locale from the session, if the request has one.
+func (h *Handler) sessionLocale(ctx context.Context) string {
+	if !h.sessionLoaded(ctx) {
+		return ""
+	}
+	return h.Core.Session.GetString(ctx, LocaleSessionKey)
+}
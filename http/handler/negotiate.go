@@ -0,0 +1,286 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/socle-lab/pkg/csv"
+	"github.com/socle-lab/render"
+)
+
+// Media types the response writers can produce.
+const (
+	MediaJSON        = "application/json"
+	MediaProblemJSON = "application/problem+json"
+	MediaXML         = "application/xml"
+	MediaProblemXML  = "application/problem+xml"
+	MediaHTML        = "text/html"
+	MediaCSV         = "text/csv"
+	MediaText        = "text/plain"
+)
+
+// Page is implemented by values that know how to render themselves as an
+// HTML page. render.PageOptions values are rendered as is.
+type Page interface {
+	PageOptions() render.PageOptions
+}
+
+type acceptRange struct {
+	typ, sub string
+	q        float64
+}
+
+// parseAccept parses an Accept header, ignoring malformed ranges.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		typ, sub, ok := strings.Cut(mediaType, "/")
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{typ: typ, sub: sub, q: q})
+	}
+	return ranges
+}
+
+// quality returns the weight the ranges give to mediaType, taken from the
+// most specific matching range, or -1 when none matches.
+func quality(ranges []acceptRange, mediaType string) float64 {
+	typ, sub, _ := strings.Cut(mediaType, "/")
+	q, specificity := -1.0, -1
+	for _, ar := range ranges {
+		s := 0
+		switch {
+		case ar.typ == typ && ar.sub == sub:
+			s = 2
+		case ar.typ == typ && ar.sub == "*":
+			s = 1
+		case ar.typ == "*" && ar.sub == "*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = ar.q, s
+		}
+	}
+	return q
+}
+
+// accepts reports whether the Accept header names mediaType itself, not
+// through a wildcard.
+func accepts(r *http.Request, mediaType string) bool {
+	typ, sub, _ := strings.Cut(mediaType, "/")
+	for _, ar := range parseAccept(r.Header.Get("Accept")) {
+		if ar.typ == typ && ar.sub == sub && ar.q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Negotiate returns the offer the request's Accept header prefers, or "" when
+// it accepts none of them. Ties are broken by the order of offers after the
+// fallback (see Fallback) has been moved first; a missing Accept header
+// selects the fallback itself.
+func (h *Handler) Negotiate(r *http.Request, offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	offers = h.preferred(r, offers)
+
+	header := r.Header.Get("Accept")
+	if strings.TrimSpace(header) == "" {
+		return offers[0]
+	}
+	ranges := parseAccept(header)
+	if len(ranges) == 0 {
+		return offers[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := quality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// Fallback is the media type used when the client expresses no preference:
+// HTML for web apps, except for XHR and JSON requests, JSON otherwise.
+func (h *Handler) Fallback(r *http.Request) string {
+	if h.Core == nil || h.Core.App.Type != "web" {
+		return MediaJSON
+	}
+	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		return MediaJSON
+	}
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct == MediaJSON {
+		return MediaJSON
+	}
+	return MediaHTML
+}
+
+// preferred returns offers with the fallback media types moved first.
+func (h *Handler) preferred(r *http.Request, offers []string) []string {
+	fallback := h.Fallback(r)
+	first := func(offer string) bool {
+		switch fallback {
+		case MediaJSON:
+			return offer == MediaJSON || offer == MediaProblemJSON
+		default:
+			return offer == fallback
+		}
+	}
+
+	sorted := make([]string, len(offers))
+	copy(sorted, offers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return first(sorted[i]) && !first(sorted[j])
+	})
+	return sorted
+}
+
+// Respond writes data with the given status in the representation negotiated
+// from the Accept header: JSON and, with h.XML, XML (wrapped in a "data"
+// envelope), CSV
+// for slices of structs, plain text for strings and fmt.Stringer values, and
+// HTML through the renderer for render.PageOptions and Page values. Clients
+// accepting none of these get the fallback representation. Non-HTML 200s
+// to GET requests carry an ETag when h.ETags is set and are answered with a
+// 304 when the client's copy is current.
+func (h *Handler) Respond(w http.ResponseWriter, r *http.Request, status int, data any) error {
+	offers := []string{MediaJSON}
+	var xmlBody []byte
+	if h.XML {
+		type envelope struct {
+			XMLName xml.Name `xml:"response"`
+			Data    any      `xml:"data"`
+		}
+		if body, err := xml.Marshal(&envelope{Data: data}); err == nil {
+			xmlBody = append([]byte(xml.Header), body...)
+			offers = append(offers, MediaXML)
+		}
+	}
+	if isStructSlice(data) {
+		offers = append(offers, MediaCSV)
+	}
+	if _, ok := textOf(data); ok {
+		offers = append(offers, MediaText)
+	}
+	page, isPage := pageOf(data)
+	if isPage {
+		offers = append(offers, MediaHTML)
+	}
+
+	w.Header().Add("Vary", "Accept")
+	mediaType := h.Negotiate(r, offers...)
+	if mediaType == "" {
+		mediaType = h.preferred(r, offers)[0]
+	}
+
+	switch mediaType {
+	case MediaHTML:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		return h.Core.Render.Page(w, r, page)
+
+	case MediaText:
+		text, _ := textOf(data)
+		return h.writeResponse(w, r, status, "text/plain; charset=utf-8", []byte(text))
+
+	case MediaCSV:
+		var buf bytes.Buffer
+		if err := csv.ExportSlice(&buf, csv.CSV, data); err != nil {
+			return err
+		}
+		return h.writeResponse(w, r, status, "text/csv; charset=utf-8", buf.Bytes())
+
+	case MediaXML:
+		return h.writeResponse(w, r, status, "application/xml; charset=utf-8", xmlBody)
+
+	default:
+		type envelope struct {
+			Data any `json:"data"`
+		}
+		body, err := json.Marshal(&envelope{Data: data})
+		if err != nil {
+			return err
+		}
+		return h.writeResponse(w, r, status, "application/json", append(body, '\n'))
+	}
+}
+
+// writeBody writes an already encoded body, so encoding errors can still be
+// reported before the status is sent.
+func writeBody(w http.ResponseWriter, status int, contentType string, body []byte) error {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_, err := w.Write(body)
+	return err
+}
+
+func isStructSlice(data any) bool {
+	t := reflect.TypeOf(data)
+	if t == nil || (t.Kind() != reflect.Slice && t.Kind() != reflect.Array) {
+		return false
+	}
+	t = t.Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+func textOf(data any) (string, bool) {
+	switch v := data.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case fmt.Stringer:
+		return v.String(), true
+	case error:
+		return v.Error(), true
+	default:
+		return "", false
+	}
+}
+
+func pageOf(data any) (render.PageOptions, bool) {
+	switch v := data.(type) {
+	case render.PageOptions:
+		return v, true
+	case *render.PageOptions:
+		if v != nil {
+			return *v, true
+		}
+	case Page:
+		return v.PageOptions(), true
+	}
+	return render.PageOptions{}, false
+}
@@ -0,0 +1,274 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ErrorFormat selects the body written by the error helpers.
+type ErrorFormat string
+
+const (
+	// ErrorFormatCompat writes the historical body, byte for byte, except to
+	// clients that explicitly accept application/problem+json, which get a
+	// problem document. This is the default.
+	ErrorFormatCompat ErrorFormat = ""
+	// ErrorFormatProblem writes plain RFC 7807 problem documents.
+	ErrorFormatProblem ErrorFormat = "problem"
+	// ErrorFormatLegacy always writes the historical {"error": "..."} body.
+	ErrorFormatLegacy ErrorFormat = "legacy"
+)
+
+const problemContentType = "application/problem+json"
+
+// FieldIssue is a field-level error of a problem document.
+type FieldIssue struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Problem is an RFC 7807 problem details document. It implements error so it
+// can be returned and wrapped like any other error; the cause is logged but
+// never serialized.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldIssue `json:"errors,omitempty"`
+
+	// Extensions are additional members merged into the document.
+	Extensions map[string]any `json:"-"`
+
+	cause error
+}
+
+// NewProblem creates a problem of type "about:blank" titled after the status.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+func (p *Problem) Unwrap() error { return p.cause }
+
+// WithCause records the underlying error, for logs only.
+func (p *Problem) WithCause(err error) *Problem {
+	p.cause = err
+	return p
+}
+
+// WithErrors appends field-level issues.
+func (p *Problem) WithErrors(issues ...FieldIssue) *Problem {
+	p.Errors = append(p.Errors, issues...)
+	return p
+}
+
+// With sets an extension member.
+func (p *Problem) With(key string, value any) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = map[string]any{}
+	}
+	p.Extensions[key] = value
+	return p
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	type document Problem
+	data, err := json.Marshal((*document)(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return data, err
+	}
+
+	// Append the extension members after the standard ones, which win on
+	// name clashes.
+	var standard map[string]json.RawMessage
+	if err := json.Unmarshal(data, &standard); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(p.Extensions))
+	for k := range p.Extensions {
+		if _, ok := standard[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	buf := bytes.NewBuffer(data[:len(data)-1])
+	for _, k := range keys {
+		key, _ := json.Marshal(k)
+		value, err := json.Marshal(p.Extensions[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// requestID returns the identifier of the request, if any. Identifiers that
+// are not up to 128 printable ASCII characters are ignored, as clients send
+// them.
+func requestID(r *http.Request) string {
+	for _, header := range []string{"X-Request-ID", "X-Correlation-ID"} {
+		if id := r.Header.Get(header); ValidRequestID(id) {
+			return id
+		}
+	}
+	return ""
+}
+
+// ValidRequestID accepts up to 128 printable ASCII characters, so client IDs
+// can't inject anything into logs or headers.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// writeProblem writes p in the requested error format. legacy is the value
+// the historical helpers used to encode; problem tells whether the client
+// explicitly asked for a problem document.
+func writeProblem(w http.ResponseWriter, format ErrorFormat, p *Problem, legacy any, problem bool) error {
+	if format == ErrorFormatLegacy || format == ErrorFormatCompat && !problem {
+		if message, ok := legacy.(string); ok {
+			return writeJSONError(w, p.Status, message)
+		}
+		return writeJSON(w, p.Status, legacy)
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	return json.NewEncoder(w).Encode(p)
+}
+
+// text returns the message of the issue, or its code.
+func (i FieldIssue) text() string {
+	if i.Message != "" {
+		return i.Message
+	}
+	if i.Param != "" {
+		return i.Code + "=" + i.Param
+	}
+	return i.Code
+}
+
+// MarshalXML encodes the problem as an RFC 7807 XML document; extensions
+// become elements named after their keys, in sorted order.
+func (p *Problem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{
+		Name: xml.Name{Local: "problem"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: "urn:ietf:rfc:7807"}},
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	element := func(name string, value any) error {
+		return e.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: name}})
+	}
+	if err := element("type", p.Type); err != nil {
+		return err
+	}
+	if err := element("title", p.Title); err != nil {
+		return err
+	}
+	if err := element("status", p.Status); err != nil {
+		return err
+	}
+	for _, member := range []struct{ name, value string }{
+		{"detail", p.Detail}, {"instance", p.Instance}, {"request_id", p.RequestID},
+	} {
+		if member.value == "" {
+			continue
+		}
+		if err := element(member.name, member.value); err != nil {
+			return err
+		}
+	}
+
+	if len(p.Errors) > 0 {
+		type issue struct {
+			Field   string `xml:"field"`
+			Code    string `xml:"code"`
+			Param   string `xml:"param,omitempty"`
+			Message string `xml:"message,omitempty"`
+		}
+		errs := make([]issue, len(p.Errors))
+		for i, fi := range p.Errors {
+			errs[i] = issue(fi)
+		}
+		if err := e.EncodeElement(errs, xml.StartElement{Name: xml.Name{Local: "errors"}}); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(p.Extensions))
+	for k := range p.Extensions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := element(k, fmt.Sprint(p.Extensions[k])); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+func writeProblemXML(w http.ResponseWriter, p *Problem) error {
+	body, err := xml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return writeBody(w, p.Status, MediaProblemXML+"; charset=utf-8", append([]byte(xml.Header), body...))
+}
+
+// writeProblemText writes the message the helpers historically sent as plain
+// text, followed by one line per field issue.
+func writeProblemText(w http.ResponseWriter, p *Problem, legacy any) error {
+	message, ok := legacy.(string)
+	if !ok || message == "" {
+		message = p.Error()
+	}
+
+	var sb strings.Builder
+	sb.WriteString(message)
+	sb.WriteByte('\n')
+	for _, issue := range p.Errors {
+		fmt.Fprintf(&sb, "%s: %s\n", issue.Field, issue.text())
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	return writeBody(w, p.Status, "text/plain; charset=utf-8", []byte(sb.String()))
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// SessionLoaded reports whether the session middleware of sm loaded the
+// session of ctx; scs panics on reads and writes otherwise. It asks scs for
+// the session status, and only recovers from the panic scs raises for a
+// missing session.
+func SessionLoaded(ctx context.Context, sm *scs.SessionManager) (loaded bool) {
+	if sm == nil {
+		return false
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			if rec != "scs: no session data in context" {
+				panic(rec)
+			}
+			loaded = false
+		}
+	}()
+	sm.Status(ctx)
+	return true
+}
+
+// sessionLoaded reports whether the session of ctx can be used.
+func (h *Handler) sessionLoaded(ctx context.Context) bool {
+	return h.Core != nil && SessionLoaded(ctx, h.Core.Session)
+}
@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStreamingUnsupported is returned when the response writer can't flush.
+var ErrStreamingUnsupported = errors.New("handler: response writer does not support flushing")
+
+// Event is a Server-Sent Event. Data is written as is when it is a string or
+// []byte (one data line per line) and as JSON otherwise.
+type Event struct {
+	ID    string
+	Event string
+	Data  any
+	// Retry tells the client how long to wait before reconnecting.
+	Retry time.Duration
+}
+
+// EventStream writes Server-Sent Events. Its methods are safe for concurrent
+// use, so a heartbeat can run alongside the sender.
+type EventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+	r  *http.Request
+	mu sync.Mutex
+}
+
+// SSE starts an event stream: it sends the text/event-stream headers and
+// lifts the server's write deadline. The stream ends when the handler
+// returns; the client going away cancels r.Context(). When w can't flush,
+// nothing is written and ErrStreamingUnsupported is returned, so the caller
+// can still answer with an error.
+func (h *Handler) SSE(w http.ResponseWriter, r *http.Request) (*EventStream, error) {
+	if !canFlush(w) {
+		return nil, ErrStreamingUnsupported
+	}
+	rc := http.NewResponseController(w)
+	hd := w.Header()
+	hd.Set("Content-Type", "text/event-stream")
+	hd.Set("Cache-Control", "no-cache")
+	hd.Set("Connection", "keep-alive")
+	hd.Set("X-Accel-Buffering", "no") // nginx
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		return nil, ErrStreamingUnsupported
+	}
+	_ = rc.SetWriteDeadline(time.Time{})
+	return &EventStream{w: w, rc: rc, r: r}, nil
+}
+
+// canFlush reports whether w, or a writer it unwraps to, can flush, the way
+// http.ResponseController looks for it, without flushing.
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		switch t := w.(type) {
+		case interface{ FlushError() error }, http.Flusher:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// LastEventID returns the ID of the last event the client received before
+// reconnecting, to resume from there.
+func (s *EventStream) LastEventID() string {
+	if id := s.r.Header.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+	return s.r.URL.Query().Get("lastEventId")
+}
+
+// Done is closed when the client disconnects.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.r.Context().Done()
+}
+
+// Send writes and flushes e.
+func (s *EventStream) Send(e Event) error {
+	var buf bytes.Buffer
+	if e.ID != "" {
+		fmt.Fprintf(&buf, "id: %s\n", oneLine(e.ID))
+	}
+	if e.Event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", oneLine(e.Event))
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&buf, "retry: %d\n", e.Retry.Milliseconds())
+	}
+
+	var data string
+	switch v := e.Data.(type) {
+	case nil:
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteByte('\n')
+	return s.write(buf.Bytes())
+}
+
+// Comment writes a comment line, which clients ignore.
+func (s *EventStream) Comment(text string) error {
+	return s.write([]byte(": " + oneLine(text) + "\n\n"))
+}
+
+func (s *EventStream) write(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.r.Context().Err(); err != nil {
+		return err
+	}
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// Heartbeat sends a comment every interval until the client disconnects or
+// stop is called, so proxies don't close an idle stream. stop returns once
+// the heartbeat no longer writes, so the handler can return.
+func (s *EventStream) Heartbeat(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	var once sync.Once
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-s.Done():
+				return
+			case <-ticker.C:
+				if s.Comment("heartbeat") != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() { close(done) })
+		<-exited
+	}
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// StreamEvents sends the events of the channel until it is closed or the
+// client disconnects, with a heartbeat every 15 seconds.
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request, events <-chan Event) error {
+	s, err := h.SSE(w, r)
+	if err != nil {
+		return err
+	}
+	defer s.Heartbeat(15 * time.Second)()
+
+	for {
+		select {
+		case <-s.Done():
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := s.Send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// NDJSONStream writes newline-delimited JSON, flushing every value.
+type NDJSONStream struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	r       *http.Request
+	started bool
+}
+
+// NDJSON returns a stream of application/x-ndjson values. Headers are sent
+// with the first value, so errors before it can still get a normal error
+// response.
+func (h *Handler) NDJSON(w http.ResponseWriter, r *http.Request) *NDJSONStream {
+	return &NDJSONStream{w: w, rc: http.NewResponseController(w), r: r}
+}
+
+// Started reports whether a value was sent.
+func (s *NDJSONStream) Started() bool {
+	return s.started
+}
+
+// Send writes v as one line and flushes it.
+func (s *NDJSONStream) Send(v any) error {
+	if err := s.r.Context().Err(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if !s.started {
+		s.started = true
+		s.w.Header().Set("Content-Type", "application/x-ndjson")
+		s.w.Header().Set("X-Accel-Buffering", "no")
+		s.w.WriteHeader(http.StatusOK)
+		_ = s.rc.SetWriteDeadline(time.Time{})
+	}
+	if _, err := s.w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// StreamNDJSON sends the items of seq as NDJSON until it ends or the client
+// disconnects. An error before the first item gets the usual error
+// response; a later one is logged and sent as a final {"error": ...} line.
+// See Chan and Seq to stream typed channels and iterators.
+func (h *Handler) StreamNDJSON(w http.ResponseWriter, r *http.Request, seq iter.Seq2[any, error]) {
+	s := h.NDJSON(w, r)
+	for item, err := range seq {
+		if err == nil {
+			err = s.Send(item)
+			if r.Context().Err() != nil {
+				return
+			}
+		}
+		if err != nil {
+			if !s.Started() {
+				h.Error(w, r, err)
+				return
+			}
+			h.logInternal(r, http.StatusOK, err)
+			s.Send(map[string]string{"error": "the stream was interrupted"})
+			return
+		}
+	}
+	if !s.Started() {
+		// Empty stream: still a valid, empty NDJSON body.
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// Chan adapts a channel to StreamNDJSON.
+func Chan[T any](ch <-chan T) iter.Seq2[any, error] {
+	return func(yield func(any, error) bool) {
+		for v := range ch {
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Seq adapts an iterator to StreamNDJSON.
+func Seq[T any](seq iter.Seq2[T, error]) iter.Seq2[any, error] {
+	return func(yield func(any, error) bool) {
+		for v, err := range seq {
+			if !yield(v, err) {
+				return
+			}
+		}
+	}
+}
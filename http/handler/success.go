@@ -2,6 +2,9 @@ package handler
 
 import "net/http"
 
+// OK writes data in a JSON envelope with a 200 status. It doesn't see the
+// request, so it ignores h.ETags and conditional requests: use OKFor (or
+// JsonFor) for those.
 func (h *Handler) OK(w http.ResponseWriter, data any) error {
 	type envelope struct {
 		Data any `json:"data"`
@@ -9,3 +12,9 @@ func (h *Handler) OK(w http.ResponseWriter, data any) error {
 
 	return writeJSON(w, http.StatusOK, &envelope{Data: data})
 }
+
+// OKFor writes data with a 200 status, in the representation negotiated from
+// the Accept header (see Respond).
+func (h *Handler) OKFor(w http.ResponseWriter, r *http.Request, data any) error {
+	return h.Respond(w, r, http.StatusOK, data)
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/socle-lab/pkg/apperr"
+	"github.com/socle-lab/pkg/auth"
+	"github.com/socle-lab/pkg/http/ws"
+)
+
+// WebSocket serves the connections of hub. With requireAuth, requests
+// without a principal (see the auth middleware) are refused with a 401
+// before the upgrade.
+func (h *Handler) WebSocket(hub *ws.Hub, requireAuth bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if requireAuth && auth.FromContext(r.Context()) == nil {
+			h.Error(w, r, apperr.Unauthorized("authentication required"))
+			return
+		}
+		if err := hub.Serve(w, r); err != nil {
+			h.Slog().ErrorContext(r.Context(), "websocket", "method", r.Method, "path", r.URL.Path, "error", err)
+		}
+	}
+}
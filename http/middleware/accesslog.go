@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// AccessLog logs one record per request at info level, once the response is
+// written: method, path (without the query, which may carry tokens), status,
+// size, duration, client IP and user agent, plus the request ID and route
+// added by the logger from the context. Mount it after RequestID and RealIP
+// so both are resolved.
+func (m *Middleware) AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := wrap(w)
+
+		defer func() {
+			m.logger().LogAttrs(r.Context(), slog.LevelInfo, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rw.status),
+				slog.Int64("bytes", rw.bytes),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("ip", ClientIP(r)),
+				slog.String("user_agent", r.UserAgent()),
+			)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
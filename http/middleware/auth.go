@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/socle-lab/pkg/apperr"
+	"github.com/socle-lab/pkg/auth"
+	"github.com/socle-lab/pkg/http/handler"
+)
+
+// Authenticator resolves the principal of a request. It returns nil, nil
+// when the request carries no credentials of its kind, and an error
+// (usually an *apperr.UnauthorizedError) when they are invalid.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*auth.Principal, error)
+}
+
+// AuthenticatorFunc adapts a function to Authenticator.
+type AuthenticatorFunc func(r *http.Request) (*auth.Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*auth.Principal, error) {
+	return f(r)
+}
+
+// Challenger is implemented by authenticators announcing their scheme in the
+// WWW-Authenticate header of 401 responses.
+type Challenger interface {
+	Challenge() (scheme, realm string)
+}
+
+// Authenticate tries the authenticators in order and puts the first
+// principal found in the request context (see auth.FromContext and
+// Handler.Principal). Invalid credentials are rejected with a 401; requests
+// without credentials go through anonymously.
+func (m *Middleware) Authenticate(authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return m.authenticate(false, authenticators)
+}
+
+// RequireAuth is Authenticate rejecting anonymous requests with a 401. Without
+// authenticators, it only checks that a previous Authenticate found a
+// principal.
+func (m *Middleware) RequireAuth(authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return m.authenticate(true, authenticators)
+}
+
+func (m *Middleware) authenticate(required bool, authenticators []Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := auth.FromContext(r.Context())
+			for _, a := range authenticators {
+				if p != nil {
+					break
+				}
+				var err error
+				if p, err = a.Authenticate(r); err != nil {
+					m.errors().Error(w, r, withChallenge(err, a))
+					return
+				}
+			}
+
+			if p == nil {
+				if required {
+					err := apperr.Unauthorized("authentication required")
+					for _, a := range authenticators {
+						if c, ok := a.(Challenger); ok {
+							err.Scheme, err.Realm = c.Challenge()
+							break
+						}
+					}
+					m.errors().Error(w, r, err)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// withChallenge sets the scheme of a's challenge on unauthorized errors,
+// wrapped or not, that have none.
+func withChallenge(err error, a Authenticator) error {
+	c, ok := a.(Challenger)
+	var unauthorized *apperr.UnauthorizedError
+	if !ok || !errors.As(err, &unauthorized) || unauthorized.Scheme != "" {
+		return err
+	}
+	cp := *unauthorized
+	cp.Scheme, cp.Realm = c.Challenge()
+	return &cp
+}
+
+// SessionUserKey is the default session key holding the user ID.
+const SessionUserKey = "userID"
+
+// SessionAuth authenticates requests whose session (Core.Session, loaded by
+// its LoadAndSave middleware) holds a user ID under key (SessionUserKey when
+// empty). load returns the principal of the ID, or nil when the user no
+// longer exists, in which case the request is anonymous.
+func (m *Middleware) SessionAuth(key string, load func(ctx context.Context, id string) (*auth.Principal, error)) Authenticator {
+	if key == "" {
+		key = SessionUserKey
+	}
+	return AuthenticatorFunc(func(r *http.Request) (*auth.Principal, error) {
+		id := m.sessionValue(r.Context(), key)
+		if id == "" {
+			return nil, nil
+		}
+		p, err := load(r.Context(), id)
+		if err != nil || p == nil {
+			return nil, err
+		}
+		if p.ID == "" {
+			p.ID = id
+		}
+		p.Method = auth.MethodSession
+		return p, nil
+	})
+}
+
+// sessionValue reads key from the session, or "" when the session
+// middleware is not loaded for this request.
+func (m *Middleware) sessionValue(ctx context.Context, key string) string {
+	if m.Core == nil || !handler.SessionLoaded(ctx, m.Core.Session) {
+		return ""
+	}
+	if v := m.Core.Session.Get(ctx, key); v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// BasicAuth authenticates HTTP Basic credentials with Verify, which returns
+// nil for wrong credentials.
+type BasicAuth struct {
+	Realm  string
+	Verify func(ctx context.Context, username, password string) (*auth.Principal, error)
+}
+
+func (a *BasicAuth) Authenticate(r *http.Request) (*auth.Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	p, err := a.Verify(r.Context(), username, password)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, apperr.Unauthorized("invalid credentials")
+	}
+	if p.ID == "" {
+		p.ID = username
+	}
+	p.Method = auth.MethodBasic
+	return p, nil
+}
+
+func (a *BasicAuth) Challenge() (string, string) {
+	return "Basic", a.Realm
+}
+
+// RequirePermission lets through principals holding one of permissions
+// under m.Policy, answering 401 to anonymous requests and 403 (see
+// Handler.ForbiddenResponse) to the others. Mount it after Authenticate.
+func (m *Middleware) RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	if m.Policy == nil {
+		panic("middleware: RequirePermission needs a Policy")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := auth.FromContext(r.Context())
+			if p == nil {
+				m.errors().Error(w, r, apperr.Unauthorized("authentication required"))
+				return
+			}
+			for _, permission := range permissions {
+				if m.Policy.Can(r.Context(), p, permission, nil) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			m.errors().ForbiddenResponse(w, r)
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/socle-lab/pkg/apperr"
+	"github.com/socle-lab/pkg/auth"
+)
+
+// HashAPIKey returns the hash under which an API key is stored.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateAPIKey returns a new random key, to hand to the client once, and
+// its hash, to store.
+func GenerateAPIKey(prefix string) (key, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key = hex.EncodeToString(b)
+	if prefix != "" {
+		key = prefix + "_" + key
+	}
+	return key, HashAPIKey(key), nil
+}
+
+// APIKeyStore finds the principal of an API key by its hash, or nil when the
+// key is unknown, expired or revoked.
+type APIKeyStore interface {
+	FindAPIKey(ctx context.Context, hash string) (*auth.Principal, error)
+}
+
+// APIKeyAuth authenticates API keys read from Header (X-API-Key by default)
+// or an "Authorization: ApiKey <key>" header. Only their hash is looked up.
+type APIKeyAuth struct {
+	Header string
+	Store  APIKeyStore
+}
+
+func (a *APIKeyAuth) Authenticate(r *http.Request) (*auth.Principal, error) {
+	header := a.Header
+	if header == "" {
+		header = "X-API-Key"
+	}
+	key := r.Header.Get(header)
+	if key == "" {
+		scheme, value, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "ApiKey") {
+			return nil, nil
+		}
+		key = strings.TrimSpace(value)
+	}
+
+	p, err := a.Store.FindAPIKey(r.Context(), HashAPIKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, apperr.Unauthorized("invalid API key")
+	}
+	p.Method = auth.MethodAPIKey
+	return p, nil
+}
+
+// MemoryAPIKeys keeps API keys in memory, by hash.
+type MemoryAPIKeys struct {
+	mu   sync.RWMutex
+	keys map[string]auth.Principal
+}
+
+func NewMemoryAPIKeys() *MemoryAPIKeys {
+	return &MemoryAPIKeys{keys: make(map[string]auth.Principal)}
+}
+
+// Add registers the key with the given hash (see HashAPIKey).
+func (s *MemoryAPIKeys) Add(hash string, p auth.Principal) {
+	s.mu.Lock()
+	s.keys[hash] = p
+	s.mu.Unlock()
+}
+
+// Revoke removes the key with the given hash.
+func (s *MemoryAPIKeys) Revoke(hash string) {
+	s.mu.Lock()
+	delete(s.keys, hash)
+	s.mu.Unlock()
+}
+
+func (s *MemoryAPIKeys) FindAPIKey(_ context.Context, hash string) (*auth.Principal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.keys[hash]
+	if !ok {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+// Querier is the part of *sql.DB used by the SQL stores of this package.
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SQLAPIKeys looks API keys up in Table (api_keys by default), with the
+// columns key_hash, user_id, name, scopes (space separated) and expires_at
+// (NULL for keys that never expire). Revoke keys by deleting their row.
+type SQLAPIKeys struct {
+	DB          Querier
+	Table       string
+	Placeholder squirrel.PlaceholderFormat // default squirrel.Dollar
+}
+
+func NewSQLAPIKeys(db Querier) *SQLAPIKeys {
+	return &SQLAPIKeys{DB: db, Table: "api_keys", Placeholder: squirrel.Dollar}
+}
+
+func (s *SQLAPIKeys) FindAPIKey(ctx context.Context, hash string) (*auth.Principal, error) {
+	ph := s.Placeholder
+	if ph == nil {
+		ph = squirrel.Dollar
+	}
+	table := s.Table
+	if table == "" {
+		table = "api_keys"
+	}
+
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(ph).
+		Select("user_id", "name", "scopes").
+		From(table).
+		Where(squirrel.Eq{"key_hash": hash}).
+		Where(squirrel.Or{squirrel.Eq{"expires_at": nil}, squirrel.Gt{"expires_at": time.Now()}}).
+		Limit(1).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		userID, name string
+		scopes       sql.NullString
+	)
+	err = s.DB.QueryRowContext(ctx, query, args...).Scan(&userID, &name, &scopes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &auth.Principal{ID: userID, Name: name, Scopes: strings.Fields(scopes.String)}, nil
+}
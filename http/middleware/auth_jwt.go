@@ -0,0 +1,295 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/socle-lab/pkg/apperr"
+	"github.com/socle-lab/pkg/auth"
+)
+
+// KeySet holds the verification keys of JWTAuth by key ID: []byte secrets
+// for HS*, *rsa.PublicKey for RS*/PS* and *ecdsa.PublicKey for ES*. Keys can
+// be added and removed while serving, to rotate them.
+type KeySet struct {
+	mu   sync.RWMutex
+	keys map[string]any
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]any)}
+}
+
+// Add registers key under kid. Private keys are reduced to their public
+// part.
+func (ks *KeySet) Add(kid string, key any) error {
+	switch k := key.(type) {
+	case string:
+		key = []byte(k)
+	case []byte, *rsa.PublicKey, *ecdsa.PublicKey:
+	case crypto.Signer:
+		return ks.Add(kid, k.Public())
+	default:
+		return fmt.Errorf("unsupported JWT key type %T", key)
+	}
+	ks.mu.Lock()
+	ks.keys[kid] = key
+	ks.mu.Unlock()
+	return nil
+}
+
+// Remove retires the key kid.
+func (ks *KeySet) Remove(kid string) {
+	ks.mu.Lock()
+	delete(ks.keys, kid)
+	ks.mu.Unlock()
+}
+
+// LoadJWKS replaces the keys with those of a JWKS file ({"keys": [...]}).
+// Keys meant for encryption are skipped.
+func (ks *KeySet) LoadJWKS(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		key, err := k.key()
+		if err != nil {
+			return fmt.Errorf("%s: key %d (%s): %w", path, i, k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+	return nil
+}
+
+// LoadJWKSFile returns a KeySet loaded from a JWKS file.
+func LoadJWKSFile(path string) (*KeySet, error) {
+	ks := NewKeySet()
+	if err := ks.LoadJWKS(path); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// keyfunc picks the key named by the token's kid or, without kid, every
+// key matching its algorithm.
+func (ks *KeySet) keyfunc(token *jwt.Token) (any, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if kid, _ := token.Header["kid"].(string); kid != "" {
+		key, ok := ks.keys[kid]
+		if !ok || !keyFits(token.Method, key) {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		return key, nil
+	}
+
+	var set jwt.VerificationKeySet
+	for _, key := range ks.keys {
+		if keyFits(token.Method, key) {
+			set.Keys = append(set.Keys, key)
+		}
+	}
+	if len(set.Keys) == 0 {
+		return nil, errors.New("no key for " + token.Method.Alg())
+	}
+	return set, nil
+}
+
+func keyFits(method jwt.SigningMethod, key any) bool {
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		_, ok := key.([]byte)
+		return ok
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		_, ok := key.(*ecdsa.PublicKey)
+		return ok
+	}
+	return false
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) key() (any, error) {
+	decode := func(s string) ([]byte, error) {
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	}
+
+	switch k.Kty {
+	case "oct":
+		return decode(k.K)
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// JWTAuth authenticates bearer JWTs signed with one of Keys. Tokens must
+// carry an expiry; issuer and audience are checked when set.
+type JWTAuth struct {
+	Keys     *KeySet
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+	// Algorithms restricts the accepted algorithms; defaults to HS256/384/512,
+	// RS256/384/512, PS256/384/512 and ES256/384/512.
+	Algorithms []string
+	// Principal builds the principal of the verified claims; defaults to
+	// JWTPrincipal.
+	Principal func(r *http.Request, claims jwt.MapClaims) (*auth.Principal, error)
+}
+
+var defaultJWTAlgorithms = []string{
+	"HS256", "HS384", "HS512",
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+}
+
+func (a *JWTAuth) Authenticate(r *http.Request) (*auth.Principal, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, nil
+	}
+
+	algorithms := a.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = defaultJWTAlgorithms
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(algorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(a.Leeway),
+	}
+	if a.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(a.Issuer))
+	}
+	if a.Audience != "" {
+		opts = append(opts, jwt.WithAudience(a.Audience))
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(strings.TrimSpace(token), claims, a.Keys.keyfunc, opts...); err != nil {
+		return nil, &apperr.UnauthorizedError{Message: "invalid token", Scheme: "Bearer", Err: err}
+	}
+
+	build := a.Principal
+	if build == nil {
+		build = JWTPrincipal
+	}
+	p, err := build(r, claims)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, &apperr.UnauthorizedError{Message: "invalid token", Scheme: "Bearer"}
+	}
+	p.Method = auth.MethodJWT
+	return p, nil
+}
+
+func (a *JWTAuth) Challenge() (string, string) {
+	return "Bearer", ""
+}
+
+// JWTPrincipal maps the standard claims: sub to ID, name, roles (array or
+// string) and scope (space separated) or scp (array) to Scopes.
+func JWTPrincipal(_ *http.Request, claims jwt.MapClaims) (*auth.Principal, error) {
+	p := &auth.Principal{Claims: claims}
+	p.ID, _ = claims.GetSubject()
+	p.Name, _ = claims["name"].(string)
+	p.Roles = claimStrings(claims["roles"])
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	} else {
+		p.Scopes = claimStrings(claims["scp"])
+	}
+	return p, nil
+}
+
+func claimStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
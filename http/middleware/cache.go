@@ -0,0 +1,253 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/socle-lab/pkg/auth"
+)
+
+// CachePolicy builds a Cache-Control header.
+type CachePolicy struct {
+	NoStore              bool
+	NoCache              bool // cache, but revalidate every time
+	Private              bool // browser only, e.g. per-user responses
+	Public               bool
+	MaxAge               time.Duration
+	SharedMaxAge         time.Duration // s-maxage, for CDNs and proxies
+	MustRevalidate       bool
+	Immutable            bool
+	StaleWhileRevalidate time.Duration
+}
+
+func (p CachePolicy) String() string {
+	if p.NoStore {
+		return "no-store"
+	}
+	var d []string
+	add := func(ok bool, directive string) {
+		if ok {
+			d = append(d, directive)
+		}
+	}
+	secs := func(v time.Duration) string { return strconv.FormatInt(int64(v/time.Second), 10) }
+
+	add(p.Public, "public")
+	add(p.Private, "private")
+	add(p.NoCache, "no-cache")
+	add(p.MaxAge > 0 || p.NoCache, "max-age="+secs(p.MaxAge))
+	add(p.SharedMaxAge > 0, "s-maxage="+secs(p.SharedMaxAge))
+	add(p.MustRevalidate, "must-revalidate")
+	add(p.Immutable, "immutable")
+	add(p.StaleWhileRevalidate > 0, "stale-while-revalidate="+secs(p.StaleWhileRevalidate))
+	return strings.Join(d, ", ")
+}
+
+// CacheOptions configures Cache.
+type CacheOptions struct {
+	// Policy is the Cache-Control of successful (2xx) GET responses that
+	// don't set their own.
+	Policy CachePolicy
+	// TTL enables the server-side cache of successful GET responses.
+	// Requests carrying a Cookie or Authorization header are only cached
+	// with a principal, part of the key: mount Cache after Authenticate.
+	TTL time.Duration
+	// Store defaults to a MemoryResponseCache.
+	Store ResponseCache
+	// Tags returns the tags of the request's response, under which
+	// ResponseCache.Invalidate drops it.
+	Tags func(r *http.Request) []string
+	// InvalidateOnWrite invalidates the Tags of successful unsafe requests
+	// (POST, PUT, PATCH, DELETE) going through the middleware.
+	InvalidateOnWrite bool
+	// MaxBodyBytes is the largest response body cached, defaults to 1mb.
+	MaxBodyBytes int64
+	// VaryHeaders are the request headers the cache key depends on, besides
+	// route, query and principal; defaults to Accept and Accept-Language.
+	VaryHeaders []string
+}
+
+// Cache sets the Cache-Control policy of successful GET responses and caches
+// them server side, keyed by path, query, principal and VaryHeaders. Cached
+// responses are served with X-Cache: HIT and honour If-None-Match. Responses
+// setting cookies, with a no-store, no-cache or private Cache-Control, in a
+// streaming format (server-sent events, NDJSON), flushed by the handler or
+// larger than MaxBodyBytes are not cached. Mount
+// it after Compress so the cache holds uncompressed bodies.
+func (m *Middleware) Cache(opts CacheOptions) func(http.Handler) http.Handler {
+	if opts.Store == nil && opts.TTL > 0 {
+		opts.Store = NewMemoryResponseCache()
+	}
+	if opts.MaxBodyBytes == 0 {
+		opts.MaxBodyBytes = 1 << 20
+	}
+	if len(opts.VaryHeaders) == 0 {
+		opts.VaryHeaders = []string{"Accept", "Accept-Language"}
+	}
+	policy := opts.Policy.String()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead:
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+				if !opts.InvalidateOnWrite || opts.Tags == nil || opts.Store == nil {
+					next.ServeHTTP(w, r)
+					return
+				}
+				rw := wrap(w)
+				next.ServeHTTP(rw, r)
+				if rw.status < http.StatusBadRequest {
+					if err := opts.Store.Invalidate(context.WithoutCancel(r.Context()), opts.Tags(r)...); err != nil {
+						m.logger().ErrorContext(r.Context(), "cache invalidation", "method", r.Method, "path", r.URL.Path, "error", err)
+					}
+				}
+				return
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if opts.TTL <= 0 || !sharedRequest(r) {
+				next.ServeHTTP(withPolicy(w, policy), r)
+				return
+			}
+
+			key := opts.key(r)
+			cached, err := opts.Store.Get(r.Context(), key)
+			if err != nil {
+				m.logger().ErrorContext(r.Context(), "cache", "method", r.Method, "path", r.URL.Path, "error", err)
+			}
+			if cached != nil {
+				serveCached(w, r, cached)
+				return
+			}
+
+			w.Header().Set("X-Cache", "MISS")
+			cw := newCaptureWriter(w, opts.MaxBodyBytes)
+			next.ServeHTTP(withPolicy(cw, policy), r)
+
+			if cw.status != http.StatusOK || r.Method == http.MethodHead || !cw.complete() || !cacheable(w.Header()) {
+				return
+			}
+			cw.header.Del("X-Cache")
+			var tags []string
+			if opts.Tags != nil {
+				tags = opts.Tags(r)
+			}
+			resp := &CachedResponse{Status: cw.status, Header: cw.header, Body: cw.body.Bytes()}
+			if err := opts.Store.Set(context.WithoutCancel(r.Context()), key, resp, tags, opts.TTL); err != nil {
+				m.logger().ErrorContext(r.Context(), "cache", "method", r.Method, "path", r.URL.Path, "error", err)
+			}
+		})
+	}
+}
+
+func (o *CacheOptions) key(r *http.Request) string {
+	sum := sha256.New()
+	sum.Write([]byte(r.URL.Path + "?" + r.URL.Query().Encode() + "\n"))
+	if p := auth.FromContext(r.Context()); p != nil {
+		sum.Write([]byte("principal:" + p.ID + "\n"))
+	}
+	for _, h := range o.VaryHeaders {
+		sum.Write([]byte(h + ":" + r.Header.Get(h) + "\n"))
+	}
+	return "respcache:" + hex.EncodeToString(sum.Sum(nil))
+}
+
+// sharedRequest reports whether the response to r may be cached under the
+// key of Cache: requests with credentials need a principal to tell users
+// apart.
+func sharedRequest(r *http.Request) bool {
+	if auth.FromContext(r.Context()) != nil {
+		return true
+	}
+	return r.Header.Get("Cookie") == "" && r.Header.Get("Authorization") == ""
+}
+
+func cacheable(h http.Header) bool {
+	if len(h.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	switch mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type")); mediaType {
+	case "text/event-stream", "application/x-ndjson":
+		return false
+	}
+	cc := strings.ToLower(h.Get("Cache-Control"))
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "no-cache") && !strings.Contains(cc, "private")
+}
+
+func serveCached(w http.ResponseWriter, r *http.Request, cached *CachedResponse) {
+	h := w.Header()
+	for name, values := range cached.Header {
+		h[name] = append([]string(nil), values...)
+	}
+	h.Set("X-Cache", "HIT")
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" && h.Get("ETag") != "" {
+		etag := strings.TrimPrefix(h.Get("ETag"), "W/")
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				h.Del("Content-Type")
+				h.Del("Content-Length")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(cached.Status)
+	if r.Method != http.MethodHead {
+		w.Write(cached.Body)
+	}
+}
+
+// withPolicy returns w setting the Cache-Control policy of 2xx responses
+// that don't set their own, as their header is written.
+func withPolicy(w http.ResponseWriter, policy string) http.ResponseWriter {
+	if policy == "" {
+		return w
+	}
+	return &policyWriter{ResponseWriter: w, policy: policy}
+}
+
+type policyWriter struct {
+	http.ResponseWriter
+	policy      string
+	wroteHeader bool
+}
+
+func (pw *policyWriter) WriteHeader(status int) {
+	if !pw.wroteHeader {
+		pw.wroteHeader = true
+		if status >= 200 && status < 300 && pw.Header().Get("Cache-Control") == "" {
+			pw.Header().Set("Cache-Control", pw.policy)
+		}
+	}
+	pw.ResponseWriter.WriteHeader(status)
+}
+
+func (pw *policyWriter) Write(b []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	return pw.ResponseWriter.Write(b)
+}
+
+func (pw *policyWriter) FlushError() error {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	return http.NewResponseController(pw.ResponseWriter).Flush()
+}
+
+func (pw *policyWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CachedResponse is a response kept by a ResponseCache.
+type CachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// ResponseCache keeps the responses of the Cache middleware.
+type ResponseCache interface {
+	// Get returns the response of key, or nil.
+	Get(ctx context.Context, key string) (*CachedResponse, error)
+	Set(ctx context.Context, key string, resp *CachedResponse, tags []string, ttl time.Duration) error
+	// Invalidate drops the responses stored with one of tags.
+	Invalidate(ctx context.Context, tags ...string) error
+}
+
+// MemoryResponseCache keeps responses in memory, for a single instance.
+type MemoryResponseCache struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryResponse
+	tags      map[string]map[string]struct{}
+	lastSweep time.Time
+}
+
+type memoryResponse struct {
+	resp    *CachedResponse
+	tags    []string
+	expires time.Time
+}
+
+func NewMemoryResponseCache() *MemoryResponseCache {
+	return &MemoryResponseCache{
+		entries: make(map[string]*memoryResponse),
+		tags:    make(map[string]map[string]struct{}),
+	}
+}
+
+func (c *MemoryResponseCache) Get(_ context.Context, key string) (*CachedResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(e.expires) {
+		c.remove(key)
+		return nil, nil
+	}
+	return e.resp, nil
+}
+
+func (c *MemoryResponseCache) Set(_ context.Context, key string, resp *CachedResponse, tags []string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) > time.Minute {
+		c.lastSweep = now
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				c.remove(k)
+			}
+		}
+	}
+
+	c.remove(key)
+	c.entries[key] = &memoryResponse{resp: resp, tags: tags, expires: now.Add(ttl)}
+	for _, tag := range tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = make(map[string]struct{})
+		}
+		c.tags[tag][key] = struct{}{}
+	}
+	return nil
+}
+
+func (c *MemoryResponseCache) Invalidate(_ context.Context, tags ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			c.remove(key)
+		}
+		delete(c.tags, tag)
+	}
+	return nil
+}
+
+func (c *MemoryResponseCache) remove(key string) {
+	e, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	delete(c.entries, key)
+	for _, tag := range e.tags {
+		delete(c.tags[tag], key)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
+
+// CacheResponseCache keeps responses in the socle cache, shared by every
+// instance. Each tag has a version stored in the cache and folded into the
+// keys of its responses: invalidating a tag bumps its version, which orphans
+// its responses until they expire.
+type CacheResponseCache struct {
+	Cache Cache
+}
+
+func NewCacheResponseCache(cache Cache) *CacheResponseCache {
+	return &CacheResponseCache{Cache: cache}
+}
+
+type cachedEntry struct {
+	Tags     map[string]string `json:"tags,omitempty"` // tag -> version
+	Response *CachedResponse   `json:"response"`
+}
+
+func (c *CacheResponseCache) Get(_ context.Context, key string) (*CachedResponse, error) {
+	ok, err := c.Cache.Has(key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var e cachedEntry
+	if err := cacheGetJSON(c.Cache, key, &e); err != nil {
+		return nil, err
+	}
+	for tag, version := range e.Tags {
+		current, err := c.version(tag)
+		if err != nil {
+			return nil, err
+		}
+		if current != version {
+			return nil, nil
+		}
+	}
+	return e.Response, nil
+}
+
+func (c *CacheResponseCache) Set(_ context.Context, key string, resp *CachedResponse, tags []string, ttl time.Duration) error {
+	e := cachedEntry{Tags: make(map[string]string, len(tags)), Response: resp}
+	for _, tag := range tags {
+		version, err := c.version(tag)
+		if err != nil {
+			return err
+		}
+		e.Tags[tag] = version
+	}
+	return cacheSetJSON(c.Cache, key, &e, ttl)
+}
+
+func (c *CacheResponseCache) Invalidate(_ context.Context, tags ...string) error {
+	for _, tag := range tags {
+		if err := cacheSetJSON(c.Cache, "respcache:tag:"+tag, newRequestID(), tagVersionTTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagVersionTTL outlives any reasonable response TTL.
+const tagVersionTTL = 30 * 24 * time.Hour
+
+func (c *CacheResponseCache) version(tag string) (string, error) {
+	key := "respcache:tag:" + tag
+	ok, err := c.Cache.Has(key)
+	if err != nil || !ok {
+		return "", err
+	}
+	var version string
+	err = cacheGetJSON(c.Cache, key, &version)
+	return version, err
+}
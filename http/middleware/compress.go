@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// CompressOptions configures Compress.
+type CompressOptions struct {
+	// Level is the compression level: gzip levels (1-9) also map to the
+	// brotli level. Zero selects the default of each encoder.
+	Level int
+	// MinSize is the size under which responses with a known Content-Length
+	// are sent uncompressed. Defaults to 1024.
+	MinSize int
+	// Types are the compressible media types; "text/*" matches a whole type.
+	// Defaults to DefaultCompressTypes.
+	Types []string
+}
+
+// DefaultCompressTypes are the media types compressed by default. Event
+// streams are left out so they are flushed as written.
+var DefaultCompressTypes = []string{
+	"text/html", "text/css", "text/plain", "text/csv", "text/xml", "text/javascript",
+	"application/json", "application/problem+json", "application/xml", "application/problem+xml",
+	"application/javascript", "application/x-ndjson", "image/svg+xml",
+}
+
+// Compress compresses responses with brotli or gzip, as negotiated from the
+// Accept-Encoding header, when their Content-Type is compressible. Responses
+// that already carry a Content-Encoding are left alone.
+func (m *Middleware) Compress(opts CompressOptions) func(http.Handler) http.Handler {
+	if opts.MinSize == 0 {
+		opts.MinSize = 1024
+	}
+	if len(opts.Types) == 0 {
+		opts.Types = DefaultCompressTypes
+	}
+	level := opts.Level
+
+	gzipPool := sync.Pool{New: func() any {
+		if level == 0 {
+			return gzip.NewWriter(io.Discard)
+		}
+		zw, err := gzip.NewWriterLevel(io.Discard, level)
+		if err != nil {
+			panic(err)
+		}
+		return zw
+	}}
+	brotliPool := sync.Pool{New: func() any {
+		if level == 0 {
+			return brotli.NewWriter(io.Discard)
+		}
+		return brotli.NewWriterLevel(io.Discard, level)
+	}}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := acceptEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, opts: &opts, encoding: encoding}
+			if encoding == "br" {
+				cw.pool = &brotliPool
+			} else {
+				cw.pool = &gzipPool
+			}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// acceptEncoding returns "br", "gzip" or "" from an Accept-Encoding header,
+// preferring brotli at equal weight.
+func acceptEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "br" && name != "gzip" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ || q == bestQ && name == "br" {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// compressWriter decides on the first write whether the response is
+// compressed, once its headers are known.
+type compressWriter struct {
+	http.ResponseWriter
+	opts     *CompressOptions
+	encoding string
+	pool     *sync.Pool
+
+	decided     bool
+	enc         encoder
+	status      int
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.decided = true
+		cw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (cw *compressWriter) decide(first []byte) {
+	cw.decided = true
+	h := cw.Header()
+
+	if h.Get("Content-Encoding") == "" && cw.compressible(h, first) {
+		enc := cw.pool.Get().(encoder)
+		enc.Reset(cw.ResponseWriter)
+		cw.enc = enc
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+	}
+
+	if cw.wroteHeader {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+}
+
+func (cw *compressWriter) compressible(h http.Header, first []byte) bool {
+	if cl := h.Get("Content-Length"); cl != "" {
+		if n, err := strconv.Atoi(cl); err == nil && n < cw.opts.MinSize {
+			return false
+		}
+	}
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		ct = http.DetectContentType(first)
+		h.Set("Content-Type", ct)
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	for _, t := range cw.opts.Types {
+		if t == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.decide(b)
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(nil)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided && cw.wroteHeader {
+		// Header without body: nothing to compress.
+		cw.decided = true
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+		cw.enc.Reset(io.Discard)
+		cw.pool.Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("middleware: response writer does not support hijacking")
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures CORS.
+type CORSOptions struct {
+	// AllowedOrigins are exact origins ("https://app.example.com"),
+	// wildcard subdomains ("https://*.example.com", which does not match
+	// the bare domain) or "*" for any origin.
+	AllowedOrigins []string
+	// AllowedOriginPatterns are regular expressions matched against the
+	// whole origin.
+	AllowedOriginPatterns []string
+	// AllowOriginFunc decides for origins not matched above.
+	AllowOriginFunc func(r *http.Request, origin string) bool
+
+	// AllowedMethods default to GET, HEAD, POST, PUT, PATCH and DELETE.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers clients may send; "*" allows
+	// any. Defaults to Accept, Accept-Language, Content-Type, Authorization,
+	// X-Requested-With, X-CSRF-Token and Idempotency-Key.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read.
+	ExposedHeaders []string
+	// AllowCredentials lets cookies and Authorization headers through; the
+	// request origin is then echoed instead of "*". It can't be combined
+	// with the "*" origin: list the trusted origins.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+var (
+	defaultCORSMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+	defaultCORSHeaders = []string{"Accept", "Accept-Language", "Content-Type", "Authorization",
+		"X-Requested-With", "X-CSRF-Token", "Idempotency-Key"}
+)
+
+// CORS answers preflight requests itself and adds the CORS headers to the
+// responses of allowed origins. Disallowed origins get no CORS header, so
+// browsers block them. It panics on an invalid origin pattern and on the
+// "*" origin with AllowCredentials.
+func (m *Middleware) CORS(opts CORSOptions) func(http.Handler) http.Handler {
+	c := newCORS(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			h.Add("Vary", "Origin")
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed := c.allowOrigin(r, origin)
+			if preflight {
+				if allowed {
+					c.preflight(h, r, origin)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if allowed {
+				c.setOrigin(h, origin)
+				if len(c.exposed) > 0 {
+					h.Set("Access-Control-Expose-Headers", c.exposed)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type cors struct {
+	opts      CORSOptions
+	any       bool
+	exact     []string
+	wildcards [][2]string // prefix, suffix
+	patterns  []*regexp.Regexp
+	methods   []string
+	headers   []string // canonical
+	anyHeader bool
+	exposed   string
+}
+
+func newCORS(opts CORSOptions) *cors {
+	c := &cors{opts: opts, methods: opts.AllowedMethods}
+	for _, o := range opts.AllowedOrigins {
+		o = strings.ToLower(strings.TrimSpace(o))
+		switch {
+		case o == "*":
+			c.any = true
+		case strings.Contains(o, "*"):
+			prefix, suffix, _ := strings.Cut(o, "*")
+			if !strings.HasSuffix(prefix, "://") || !strings.HasPrefix(suffix, ".") {
+				panic(fmt.Sprintf("middleware: invalid CORS origin %q", o))
+			}
+			c.wildcards = append(c.wildcards, [2]string{prefix, suffix})
+		default:
+			c.exact = append(c.exact, o)
+		}
+	}
+	for _, p := range opts.AllowedOriginPatterns {
+		re, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			panic(fmt.Sprintf("middleware: invalid CORS origin pattern %q: %v", p, err))
+		}
+		c.patterns = append(c.patterns, re)
+	}
+	if c.any && opts.AllowCredentials {
+		panic(`middleware: CORS AllowCredentials can't be combined with the "*" origin`)
+	}
+
+	if len(c.methods) == 0 {
+		c.methods = defaultCORSMethods
+	}
+	headers := opts.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	for _, h := range headers {
+		if h == "*" {
+			c.anyHeader = true
+			continue
+		}
+		c.headers = append(c.headers, http.CanonicalHeaderKey(h))
+	}
+	c.exposed = strings.Join(opts.ExposedHeaders, ", ")
+	return c
+}
+
+func (c *cors) allowOrigin(r *http.Request, origin string) bool {
+	if c.any {
+		return true
+	}
+	o := strings.ToLower(origin)
+	if slices.Contains(c.exact, o) {
+		return true
+	}
+	for _, w := range c.wildcards {
+		if len(o) > len(w[0])+len(w[1]) && strings.HasPrefix(o, w[0]) && strings.HasSuffix(o, w[1]) &&
+			isHostLabels(o[len(w[0]):len(o)-len(w[1])]) {
+			return true
+		}
+	}
+	for _, re := range c.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return c.opts.AllowOriginFunc != nil && c.opts.AllowOriginFunc(r, origin)
+}
+
+// isHostLabels reports whether s is made of DNS labels, so a wildcard can't
+// swallow a port, path or another domain.
+func isHostLabels(s string) bool {
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return !strings.HasPrefix(s, ".") && !strings.HasSuffix(s, ".")
+}
+
+func (c *cors) setOrigin(h http.Header, origin string) {
+	if c.any && !c.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *cors) preflight(h http.Header, r *http.Request, origin string) {
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if !slices.Contains(c.methods, method) {
+		return
+	}
+
+	var requested []string
+	for _, v := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				requested = append(requested, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	if !c.anyHeader {
+		for _, name := range requested {
+			if !slices.Contains(c.headers, name) {
+				return
+			}
+		}
+	}
+
+	c.setOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(c.methods, ", "))
+	if len(requested) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if c.opts.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.opts.MaxAge/time.Second)))
+	}
+}
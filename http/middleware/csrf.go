@@ -0,0 +1,242 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/socle-lab/pkg/auth"
+	"github.com/socle-lab/pkg/http/form"
+	"github.com/socle-lab/pkg/http/handler"
+)
+
+// CSRFMode selects where the CSRF middleware keeps the reference token.
+type CSRFMode int
+
+const (
+	// CSRFSession keeps the token in the session (synchronizer token); it
+	// needs the session middleware, mounted before CSRF, and fails requests
+	// with a 500 without it.
+	CSRFSession CSRFMode = iota
+	// CSRFCookie keeps the token in a cookie the client submits back along
+	// with the form field or header (double submit). The cookie is signed
+	// with Core.EncryptionKey, which this mode requires, and bound to the
+	// principal of the request: mount CSRF after Authenticate.
+	CSRFCookie
+)
+
+// CSRFOptions configures CSRF.
+type CSRFOptions struct {
+	Mode CSRFMode
+	// Header carries the token of fetch requests, defaults to X-CSRF-Token.
+	Header string
+	// SessionKey defaults to "csrf_token".
+	SessionKey string
+
+	// Cookie settings of CSRFCookie; the cookie is HttpOnly.
+	CookieName   string // defaults to "csrf_token"
+	CookiePath   string // defaults to "/"
+	CookieDomain string
+	Secure       bool
+	SameSite     http.SameSite // defaults to Lax
+
+	// Exempt lists the routes not checked, as "METHOD /pattern", "/pattern"
+	// or "/prefix/*" (webhooks, token-authenticated APIs).
+	Exempt []string
+	// ExemptFunc exempts requests dynamically.
+	ExemptFunc func(r *http.Request) bool
+}
+
+const csrfTokenLen = 32
+
+var errCSRFNoSession = errors.New("middleware: CSRF in session mode needs the session middleware mounted before it")
+
+// CSRF checks that unsafe requests (other than GET, HEAD, OPTIONS and TRACE)
+// send back the request's token, in the form field form.CSRFFieldName or
+// the Header. Failures get the forbidden response. The token of each
+// request is masked anew (so it can't leak through compression) and is
+// available to templates through form.CSRFToken and form.CSRFField, which
+// Handler.Render exposes as csrfToken() and csrfField() (see
+// form.CSRFPageOptions). Form bodies are parsed within the limits of
+// Handler.ParseForm.
+func (m *Middleware) CSRF(opts CSRFOptions) func(http.Handler) http.Handler {
+	if opts.Mode == CSRFCookie && m.Core.EncryptionKey == "" {
+		panic("middleware: CSRFCookie needs Core.EncryptionKey")
+	}
+	if opts.Header == "" {
+		opts.Header = "X-CSRF-Token"
+	}
+	if opts.SessionKey == "" {
+		opts.SessionKey = "csrf_token"
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = "csrf_token"
+	}
+	if opts.CookiePath == "" {
+		opts.CookiePath = "/"
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if opts.Mode == CSRFSession && !handler.SessionLoaded(r.Context(), m.Core.Session) {
+				m.errors().InternalServerErrorResponse(w, r, errCSRFNoSession)
+				return
+			}
+			token := m.csrfLoad(r, &opts)
+			if token == nil {
+				token = make([]byte, csrfTokenLen)
+				if _, err := rand.Read(token); err != nil {
+					m.errors().Error(w, r, err)
+					return
+				}
+				m.csrfSave(w, r, &opts, token)
+			}
+			if opts.Mode == CSRFCookie {
+				w.Header().Add("Vary", "Cookie")
+			}
+			r = r.WithContext(form.WithCSRFToken(r.Context(), maskCSRF(token)))
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				next.ServeHTTP(w, r)
+				return
+			}
+			if csrfExempt(r, &opts) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			sent := r.Header.Get(opts.Header)
+			if sent == "" {
+				if err := m.errors().ParseForm(w, r); err != nil {
+					m.errors().Error(w, r, err)
+					return
+				}
+				sent = r.PostForm.Get(form.CSRFFieldName)
+			}
+			if !validCSRF(token, sent) {
+				m.logger().WarnContext(r.Context(), "invalid CSRF token", "method", r.Method, "path", r.URL.Path)
+				m.errors().ForbiddenResponse(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (m *Middleware) csrfLoad(r *http.Request, opts *CSRFOptions) []byte {
+	var encoded string
+	if opts.Mode == CSRFCookie {
+		c, err := r.Cookie(opts.CookieName)
+		if err != nil {
+			return nil
+		}
+		encoded = m.csrfVerifyCookie(r, c.Value)
+	} else {
+		encoded = m.Core.Session.GetString(r.Context(), opts.SessionKey)
+	}
+
+	token, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(token) != csrfTokenLen {
+		return nil
+	}
+	return token
+}
+
+func (m *Middleware) csrfSave(w http.ResponseWriter, r *http.Request, opts *CSRFOptions, token []byte) {
+	encoded := base64.RawURLEncoding.EncodeToString(token)
+	if opts.Mode != CSRFCookie {
+		m.Core.Session.Put(r.Context(), opts.SessionKey, encoded)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     opts.CookieName,
+		Value:    encoded + "." + m.csrfMAC(r, encoded),
+		Path:     opts.CookiePath,
+		Domain:   opts.CookieDomain,
+		Secure:   opts.Secure,
+		HttpOnly: true,
+		SameSite: opts.SameSite,
+	})
+}
+
+// csrfMAC signs a cookie token for the principal of r, so a cookie planted
+// by a sibling subdomain is only valid for the anonymous requests of the
+// planter.
+func (m *Middleware) csrfMAC(r *http.Request, value string) string {
+	var subject string
+	if p := auth.FromContext(r.Context()); p != nil {
+		subject = p.ID
+	}
+	mac := hmac.New(sha256.New, []byte(m.Core.EncryptionKey))
+	mac.Write([]byte("csrf\x00" + subject + "\x00" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// csrfVerifyCookie returns the token of a cookie value, or "" when its
+// signature is wrong.
+func (m *Middleware) csrfVerifyCookie(r *http.Request, cookie string) string {
+	value, sig, ok := strings.Cut(cookie, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(m.csrfMAC(r, value))) {
+		return ""
+	}
+	return value
+}
+
+// maskCSRF returns pad || pad^token, encoded.
+func maskCSRF(token []byte) string {
+	masked := make([]byte, 2*len(token))
+	pad := masked[:len(token)]
+	if _, err := rand.Read(pad); err != nil {
+		panic(err)
+	}
+	for i, b := range token {
+		masked[len(token)+i] = pad[i] ^ b
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+func validCSRF(token []byte, sent string) bool {
+	masked, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(sent))
+	if err != nil || len(masked) != 2*len(token) {
+		return false
+	}
+	unmasked := make([]byte, len(token))
+	for i := range token {
+		unmasked[i] = masked[i] ^ masked[len(token)+i]
+	}
+	return subtle.ConstantTimeCompare(unmasked, token) == 1
+}
+
+func csrfExempt(r *http.Request, opts *CSRFOptions) bool {
+	if opts.ExemptFunc != nil && opts.ExemptFunc(r) {
+		return true
+	}
+	if len(opts.Exempt) == 0 {
+		return false
+	}
+	pattern := RoutePattern(r)
+	for _, e := range opts.Exempt {
+		if method, p, ok := strings.Cut(e, " "); ok {
+			if method != r.Method {
+				continue
+			}
+			e = p
+		}
+		if e == pattern {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(e, "*"); ok && strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,313 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/socle-lab/pkg/auth"
+	"github.com/socle-lab/pkg/http/handler"
+)
+
+// IdempotencyRecord is what an IdempotencyStore keeps for a key: the
+// fingerprint of the first request and, once it completed, its response.
+// Status is 0 while the first request is in flight.
+type IdempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// IdempotencyStore keeps idempotency records until they expire.
+type IdempotencyStore interface {
+	// Begin records key as in flight with fingerprint until lease expires,
+	// unless it is already taken: it then returns the existing record and
+	// stores nothing.
+	Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (*IdempotencyRecord, error)
+	// Complete stores the response of key until ttl expires.
+	Complete(ctx context.Context, key string, rec *IdempotencyRecord, ttl time.Duration) error
+	// Release forgets key, so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyOptions configures Idempotency.
+type IdempotencyOptions struct {
+	// Store defaults to a MemoryIdempotencyStore.
+	Store IdempotencyStore
+	// TTL is how long completed keys are remembered, defaults to 24h.
+	TTL time.Duration
+	// Lease is how long a key stays locked by a request in flight, so the
+	// key of a crashed instance is freed; defaults to 1m. A request running
+	// longer may be run again by a retry.
+	Lease time.Duration
+	// Header defaults to Idempotency-Key.
+	Header string
+	// Methods default to POST and PATCH.
+	Methods []string
+	// Required rejects requests of Methods without key with a 400.
+	Required bool
+	// MaxBodyBytes bounds the bodies read to fingerprint requests, defaults
+	// to 32mb, the upload limit of the handler. Bodies are hashed as they
+	// are read, kept in memory up to 1mb and spooled to a temporary file
+	// beyond.
+	MaxBodyBytes int64
+	// MaxResponseBytes bounds the responses stored for replay, defaults to
+	// 1mb. Larger or streamed (flushed) responses release their key instead,
+	// so retries run the request again.
+	MaxResponseBytes int64
+}
+
+// idempotencyMemoryBytes is the part of a body kept in memory.
+const idempotencyMemoryBytes = 1 << 20
+
+// Idempotency makes unsafe requests carrying an Idempotency-Key safe to
+// retry. The first request with a key runs and its response (status,
+// headers except Set-Cookie, body) is stored; repeats get it replayed with
+// an Idempotent-Replayed header. A repeat arriving while the first request
+// is still running gets a 409, and reusing a key for a different request
+// (method, path or body) a 422. Keys are scoped to the principal. Failed
+// requests (5xx or panics) release their key so they can be retried, as do
+// responses too large to store or streamed.
+func (m *Middleware) Idempotency(opts IdempotencyOptions) func(http.Handler) http.Handler {
+	if opts.Store == nil {
+		opts.Store = NewMemoryIdempotencyStore()
+	}
+	if opts.TTL == 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	if opts.Lease == 0 {
+		opts.Lease = time.Minute
+	}
+	if opts.Header == "" {
+		opts.Header = "Idempotency-Key"
+	}
+	if len(opts.Methods) == 0 {
+		opts.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if opts.MaxBodyBytes == 0 {
+		opts.MaxBodyBytes = 32 << 20
+	}
+	if opts.MaxResponseBytes == 0 {
+		opts.MaxResponseBytes = 1 << 20
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(opts.Methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := r.Header.Get(opts.Header)
+			if key == "" {
+				if opts.Required {
+					m.errors().ProblemResponse(w, r,
+						handler.NewProblem(http.StatusBadRequest, fmt.Sprintf("the %s header is required", opts.Header)))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > 255 {
+				m.errors().ProblemResponse(w, r,
+					handler.NewProblem(http.StatusBadRequest, fmt.Sprintf("the %s header is longer than 255 characters", opts.Header)))
+				return
+			}
+
+			sum := sha256.New()
+			fmt.Fprintf(sum, "%s %s\n", r.Method, r.URL.RequestURI())
+			body, err := spoolBody(http.MaxBytesReader(w, r.Body, opts.MaxBodyBytes), sum)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					m.errors().Error(w, r, &handler.DecodeError{
+						Status:  http.StatusRequestEntityTooLarge,
+						Message: fmt.Sprintf("body must not be larger than %d bytes", opts.MaxBodyBytes),
+						Err:     err,
+					})
+					return
+				}
+				m.errors().BadRequestResponse(w, r, err)
+				return
+			}
+			defer body.Close()
+			r.Body = body
+
+			if p := auth.FromContext(r.Context()); p != nil {
+				key = p.ID + ":" + key
+			}
+			key = "idempotency:" + key
+			fingerprint := hex.EncodeToString(sum.Sum(nil))
+
+			rec, err := opts.Store.Begin(r.Context(), key, fingerprint, opts.Lease)
+			if err != nil {
+				m.errors().Error(w, r, err)
+				return
+			}
+			if rec != nil {
+				m.replay(w, r, rec, fingerprint)
+				return
+			}
+
+			cw := newCaptureWriter(w, opts.MaxResponseBytes)
+			completed := false
+			defer func() {
+				if !completed {
+					// Panic: let the client retry.
+					opts.Store.Release(context.WithoutCancel(r.Context()), key)
+				}
+			}()
+			next.ServeHTTP(cw, r)
+			completed = true
+
+			ctx := context.WithoutCancel(r.Context())
+			if cw.status >= http.StatusInternalServerError || !cw.complete() {
+				err = opts.Store.Release(ctx, key)
+			} else {
+				err = opts.Store.Complete(ctx, key, &IdempotencyRecord{
+					Fingerprint: fingerprint,
+					Status:      cw.status,
+					Header:      cw.header,
+					Body:        cw.body.Bytes(),
+				}, opts.TTL)
+			}
+			if err != nil {
+				m.logger().ErrorContext(r.Context(), "idempotency", "method", r.Method, "path", r.URL.Path, "error", err)
+			}
+		})
+	}
+}
+
+func (m *Middleware) replay(w http.ResponseWriter, r *http.Request, rec *IdempotencyRecord, fingerprint string) {
+	switch {
+	case rec.Fingerprint != fingerprint:
+		m.errors().ProblemResponse(w, r, handler.NewProblem(http.StatusUnprocessableEntity,
+			"the idempotency key was already used for a different request"))
+	case rec.Status == 0:
+		m.errors().ProblemResponse(w, r, handler.NewProblem(http.StatusConflict,
+			"a request with the same idempotency key is in progress"))
+	default:
+		h := w.Header()
+		for name, values := range rec.Header {
+			h[name] = append([]string(nil), values...)
+		}
+		h.Set("Idempotent-Replayed", "true")
+		w.WriteHeader(rec.Status)
+		w.Write(rec.Body)
+	}
+}
+
+// spoolBody reads body through hash, keeping it in memory up to
+// idempotencyMemoryBytes and in a temporary file beyond, and returns a body
+// reading it again. Closing it removes the file.
+func spoolBody(body io.Reader, hash io.Writer) (io.ReadCloser, error) {
+	var buf bytes.Buffer
+	_, err := io.CopyN(io.MultiWriter(&buf, hash), body, idempotencyMemoryBytes+1)
+	if err == io.EOF {
+		return io.NopCloser(&buf), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp("", "idempotency-*")
+	if err != nil {
+		return nil, err
+	}
+	spooled := &spooledBody{Reader: io.MultiReader(&buf, f), file: f}
+	if _, err := io.Copy(io.MultiWriter(f, hash), body); err != nil {
+		spooled.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		spooled.Close()
+		return nil, err
+	}
+	return spooled, nil
+}
+
+type spooledBody struct {
+	io.Reader
+	file *os.File
+}
+
+func (b *spooledBody) Close() error {
+	b.file.Close()
+	return os.Remove(b.file.Name())
+}
+
+// captureWriter writes the response through while keeping a copy of up to
+// limit bytes (no limit when 0). The copy is dropped when the body passes
+// the limit or the handler flushes, as streams do.
+type captureWriter struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	limit       int64
+	dropped     bool
+	wroteHeader bool
+}
+
+func newCaptureWriter(w http.ResponseWriter, limit int64) *captureWriter {
+	return &captureWriter{ResponseWriter: w, status: http.StatusOK, limit: limit}
+}
+
+// complete reports whether the copy holds the whole response.
+func (cw *captureWriter) complete() bool {
+	return !cw.dropped
+}
+
+func (cw *captureWriter) drop() {
+	cw.dropped = true
+	cw.body = bytes.Buffer{}
+}
+
+func (cw *captureWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		cw.status = status
+		cw.header = cw.Header().Clone()
+		cw.header.Del("Set-Cookie")
+		cw.header.Del("Date")
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.dropped {
+		if cw.limit > 0 && int64(cw.body.Len()+len(b)) > cw.limit {
+			cw.drop()
+		} else {
+			cw.body.Write(b)
+		}
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *captureWriter) Flush() {
+	cw.FlushError()
+}
+
+func (cw *captureWriter) FlushError() error {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	cw.drop()
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *captureWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
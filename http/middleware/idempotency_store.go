@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// MemoryIdempotencyStore keeps idempotency records in memory, for a single
+// instance. Expired records are swept as new requests come in.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[string]*memoryRecord
+	lastSweep time.Time
+}
+
+type memoryRecord struct {
+	IdempotencyRecord
+	expires time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]*memoryRecord)}
+}
+
+func (s *MemoryIdempotencyStore) Begin(_ context.Context, key, fingerprint string, lease time.Duration) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	if rec, ok := s.records[key]; ok && !now.After(rec.expires) {
+		cp := rec.IdempotencyRecord
+		return &cp, nil
+	}
+	s.records[key] = &memoryRecord{IdempotencyRecord: IdempotencyRecord{Fingerprint: fingerprint}, expires: now.Add(lease)}
+	return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, rec := range s.records {
+		if now.After(rec.expires) {
+			delete(s.records, key)
+		}
+	}
+}
+
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, rec *IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	s.records[key] = &memoryRecord{IdempotencyRecord: *rec, expires: time.Now().Add(ttl)}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	delete(s.records, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// SQLIdempotencyStore keeps idempotency records in Table (idempotency_keys
+// by default), whose primary key must be the idempotency_key column:
+//
+//	CREATE TABLE idempotency_keys (
+//		idempotency_key VARCHAR(512) PRIMARY KEY,
+//		fingerprint     VARCHAR(64) NOT NULL,
+//		status          INTEGER NOT NULL DEFAULT 0,
+//		header          TEXT,
+//		body            BYTEA,
+//		expires_at      TIMESTAMP NOT NULL
+//	);
+//
+// The primary key makes Begin atomic across instances.
+type SQLIdempotencyStore struct {
+	DB          IdempotencyDB
+	Table       string
+	Placeholder squirrel.PlaceholderFormat // default squirrel.Dollar
+}
+
+// IdempotencyDB is the part of *sql.DB (or *sql.Tx) used by
+// SQLIdempotencyStore.
+type IdempotencyDB interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func NewSQLIdempotencyStore(db IdempotencyDB) *SQLIdempotencyStore {
+	return &SQLIdempotencyStore{DB: db, Table: "idempotency_keys", Placeholder: squirrel.Dollar}
+}
+
+func (s *SQLIdempotencyStore) builder() (squirrel.StatementBuilderType, string) {
+	ph := s.Placeholder
+	if ph == nil {
+		ph = squirrel.Dollar
+	}
+	table := s.Table
+	if table == "" {
+		table = "idempotency_keys"
+	}
+	return squirrel.StatementBuilder.PlaceholderFormat(ph), table
+}
+
+func (s *SQLIdempotencyStore) exec(ctx context.Context, q squirrel.Sqlizer) error {
+	query, args, err := q.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s *SQLIdempotencyStore) Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (*IdempotencyRecord, error) {
+	b, table := s.builder()
+	now := time.Now()
+
+	err := s.exec(ctx, b.Delete(table).Where(squirrel.Eq{"idempotency_key": key}).Where(squirrel.Lt{"expires_at": now}))
+	if err != nil {
+		return nil, err
+	}
+
+	insertErr := s.exec(ctx, b.Insert(table).
+		Columns("idempotency_key", "fingerprint", "status", "expires_at").
+		Values(key, fingerprint, 0, now.Add(lease)))
+	if insertErr == nil {
+		return nil, nil
+	}
+
+	// The insert failed: most likely a duplicate key, which the row tells.
+	query, args, err := b.Select("fingerprint", "status", "header", "body").
+		From(table).
+		Where(squirrel.Eq{"idempotency_key": key}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		rec    IdempotencyRecord
+		header sql.NullString
+	)
+	err = s.DB.QueryRowContext(ctx, query, args...).Scan(&rec.Fingerprint, &rec.Status, &header, &rec.Body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, insertErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if header.Valid && header.String != "" {
+		if err := json.Unmarshal([]byte(header.String), &rec.Header); err != nil {
+			return nil, fmt.Errorf("idempotency record %s: %w", key, err)
+		}
+	}
+	return &rec, nil
+}
+
+func (s *SQLIdempotencyStore) Complete(ctx context.Context, key string, rec *IdempotencyRecord, ttl time.Duration) error {
+	header, err := json.Marshal(rec.Header)
+	if err != nil {
+		return err
+	}
+	b, table := s.builder()
+	return s.exec(ctx, b.Update(table).
+		Set("status", rec.Status).
+		Set("header", string(header)).
+		Set("body", rec.Body).
+		Set("expires_at", time.Now().Add(ttl)).
+		Where(squirrel.Eq{"idempotency_key": key}))
+}
+
+func (s *SQLIdempotencyStore) Release(ctx context.Context, key string) error {
+	b, table := s.builder()
+	return s.exec(ctx, b.Delete(table).Where(squirrel.Eq{"idempotency_key": key}))
+}
+
+// CacheIdempotencyStore keeps idempotency records in the socle cache. The
+// cache has no atomic add-if-absent, so Begin is serialized per key and
+// instance only: it can't guarantee the 409 of concurrent duplicates across
+// instances, which may both run the request. Use SQLIdempotencyStore for
+// that.
+type CacheIdempotencyStore struct {
+	Cache IdempotencyCache
+	locks keyLocks
+}
+
+// IdempotencyCache is the part of the socle cache used by
+// CacheIdempotencyStore.
+type IdempotencyCache interface {
+	Cache
+	Forget(key string) error
+}
+
+func NewCacheIdempotencyStore(cache IdempotencyCache) *CacheIdempotencyStore {
+	return &CacheIdempotencyStore{Cache: cache}
+}
+
+func (s *CacheIdempotencyStore) Begin(_ context.Context, key, fingerprint string, lease time.Duration) (*IdempotencyRecord, error) {
+	mu := s.locks.of(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	ok, err := s.Cache.Has(key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		rec := &IdempotencyRecord{}
+		if err := cacheGetJSON(s.Cache, key, rec); err != nil {
+			return nil, err
+		}
+		return rec, nil
+	}
+	return nil, cacheSetJSON(s.Cache, key, &IdempotencyRecord{Fingerprint: fingerprint}, lease)
+}
+
+func (s *CacheIdempotencyStore) Complete(_ context.Context, key string, rec *IdempotencyRecord, ttl time.Duration) error {
+	return cacheSetJSON(s.Cache, key, rec, ttl)
+}
+
+func (s *CacheIdempotencyStore) Release(_ context.Context, key string) error {
+	return s.Cache.Forget(key)
+}
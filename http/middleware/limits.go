@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/socle-lab/pkg/http/handler"
+)
+
+// Timeout gives each request a context deadline of d. Handlers must honour
+// r.Context(); when the deadline passes before anything was written, a 503
+// is sent once the handler returns.
+func (m *Middleware) Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			rw := wrap(w)
+			next.ServeHTTP(rw, r.WithContext(ctx))
+
+			if !rw.wroteHeader && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				m.errors().ProblemResponse(rw, r,
+					handler.NewProblem(http.StatusServiceUnavailable, fmt.Sprintf("request timed out after %s", d)))
+			}
+		})
+	}
+}
+
+// BodyLimit rejects bodies larger than n bytes with a 413: upfront when the
+// Content-Length is known, while reading otherwise (the read then fails with
+// an *http.MaxBytesError, which Handler.Decode reports as a 413).
+func (m *Middleware) BodyLimit(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				m.errors().ProblemResponse(w, r,
+					handler.NewProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("body must not be larger than %d bytes", n)))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
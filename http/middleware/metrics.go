@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/socle-lab/pkg/metrics"
+)
+
+// Metrics records the requests in reg (metrics.Default when nil):
+//
+//	http_requests_total{method,route,status}
+//	http_request_duration_seconds{method,route}
+//	http_request_size_bytes{method,route}
+//	http_response_size_bytes{method,route}
+//	http_requests_in_flight
+//
+// route is the chi route pattern, never the raw path, so series stay
+// bounded; requests matching no route are recorded as "unmatched". For the
+// same reason, methods other than the standard ones are recorded as "other".
+func (m *Middleware) Metrics(reg *metrics.Registry) func(http.Handler) http.Handler {
+	if reg == nil {
+		reg = metrics.Default
+	}
+	var (
+		requests = reg.Counter("http_requests_total", "Number of HTTP requests.", "method", "route", "status")
+		duration = reg.Histogram("http_request_duration_seconds", "Duration of HTTP requests.", nil, "method", "route")
+		reqSize  = reg.Histogram("http_request_size_bytes", "Size of HTTP request bodies.", metrics.SizeBuckets, "method", "route")
+		respSize = reg.Histogram("http_response_size_bytes", "Size of HTTP response bodies.", metrics.SizeBuckets, "method", "route")
+		inFlight = reg.Gauge("http_requests_in_flight", "Number of HTTP requests being served.").With()
+	)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := wrap(w)
+			inFlight.Inc()
+
+			defer func() {
+				inFlight.Dec()
+				method, route := metricsMethod(r.Method), metricsRoute(r)
+				requests.With(method, route, strconv.Itoa(rw.status)).Inc()
+				duration.With(method, route).ObserveSince(start)
+				if r.ContentLength >= 0 {
+					reqSize.With(method, route).Observe(float64(r.ContentLength))
+				}
+				respSize.With(method, route).Observe(float64(rw.bytes))
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// metricsRoute is the route pattern matched once the request is served;
+// unlike RoutePattern it never falls back to the path.
+func metricsRoute(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return "unmatched"
+	}
+	pattern := rctx.RoutePattern()
+	if pattern == "" || pattern == "/*" {
+		return "unmatched"
+	}
+	return pattern
+}
+
+// metricsMethod maps the methods clients may make up to "other".
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
@@ -1,9 +1,86 @@
 package middleware
 
 import (
+	"bufio"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+
 	"github.com/socle-lab/core"
+	"github.com/socle-lab/pkg/auth"
+	"github.com/socle-lab/pkg/http/handler"
 )
 
+// Middleware holds the middlewares of an app. They all have the
+// func(http.Handler) http.Handler shape expected by chi's Use; the
+// configurable ones are built by a method taking their options.
 type Middleware struct {
 	Core *core.Core
+	// Handler writes the error responses of the middlewares, so they follow
+	// the app's error format and content negotiation. Defaults to a
+	// handler.Handler on Core.
+	Handler *handler.Handler
+	// Policy decides the permissions checked by RequirePermission.
+	Policy auth.Policy
+}
+
+func (m *Middleware) errors() *handler.Handler {
+	if m.Handler != nil {
+		return m.Handler
+	}
+	return &handler.Handler{Core: m.Core}
+}
+
+func (m *Middleware) logger() *slog.Logger {
+	return m.errors().Slog()
+}
+
+// responseWriter records the status and size of a response.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func wrap(w http.ResponseWriter) *responseWriter {
+	if rw, ok := w.(*responseWriter); ok {
+		return rw
+	}
+	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+func (rw *responseWriter) Flush() {
+	rw.wroteHeader = true
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := rw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("middleware: response writer does not support hijacking")
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
@@ -0,0 +1,320 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Algorithm selects how a RateLimit counts requests.
+type Algorithm int
+
+const (
+	// TokenBucket refills Limit tokens per Window up to Burst, allowing
+	// short bursts over a steady rate.
+	TokenBucket Algorithm = iota
+	// SlidingWindow allows Limit requests over any Window, weighting the
+	// previous window's count by its overlap with the sliding one.
+	SlidingWindow
+)
+
+// RateLimit is a limit of Limit requests per Window.
+type RateLimit struct {
+	Limit     int
+	Window    time.Duration
+	Burst     int // token bucket capacity, defaults to Limit
+	Algorithm Algorithm
+}
+
+func (l RateLimit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Limit
+}
+
+// policy formats the limit for the RateLimit-Policy header. Its quota is
+// the one of RateLimit-Limit: for the token bucket, Burst requests over the
+// time an empty bucket takes to refill.
+func (l RateLimit) policy() string {
+	quota, window := l.Limit, l.Window
+	if l.Algorithm == TokenBucket {
+		quota = l.burst()
+		window = time.Duration(float64(l.Window) * float64(quota) / float64(l.Limit))
+	}
+	return fmt.Sprintf("%d;w=%d", quota, int64(math.Ceil(window.Seconds())))
+}
+
+// RateLimitResult is the outcome of a request against a RateLimit.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the limit is fully available again
+	RetryAfter time.Duration // until the next request is allowed, when denied
+}
+
+// rateState is the stored state of a key, shared by both algorithms.
+type rateState struct {
+	Tokens float64 `json:"tokens,omitempty"`
+	Last   int64   `json:"last,omitempty"`  // token bucket: last refill, unix nanos
+	Start  int64   `json:"start,omitempty"` // sliding window: current window start, unix nanos
+	Prev   int     `json:"prev,omitempty"`
+	Curr   int     `json:"curr,omitempty"`
+}
+
+// take counts one request at now against st.
+func (l RateLimit) take(st *rateState, now time.Time) RateLimitResult {
+	if l.Algorithm == SlidingWindow {
+		return l.takeWindow(st, now)
+	}
+	return l.takeBucket(st, now)
+}
+
+func (l RateLimit) takeBucket(st *rateState, now time.Time) RateLimitResult {
+	capacity := float64(l.burst())
+	rate := float64(l.Limit) / float64(l.Window) // tokens per nanosecond
+
+	if st.Last == 0 {
+		st.Tokens = capacity
+	} else if elapsed := now.UnixNano() - st.Last; elapsed > 0 {
+		st.Tokens = math.Min(capacity, st.Tokens+float64(elapsed)*rate)
+	}
+	st.Last = now.UnixNano()
+
+	res := RateLimitResult{Limit: l.burst()}
+	if st.Tokens >= 1 {
+		st.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration(math.Ceil((1 - st.Tokens) / rate))
+	}
+	res.Remaining = int(st.Tokens)
+	res.Reset = time.Duration(math.Ceil((capacity - st.Tokens) / rate))
+	return res
+}
+
+func (l RateLimit) takeWindow(st *rateState, now time.Time) RateLimitResult {
+	window := int64(l.Window)
+	start := now.UnixNano() - now.UnixNano()%window
+	switch {
+	case st.Start == start:
+	case st.Start == start-window:
+		st.Prev, st.Curr = st.Curr, 0
+	default:
+		st.Prev, st.Curr = 0, 0
+	}
+	st.Start = start
+
+	elapsed := float64(now.UnixNano()-start) / float64(window)
+	count := float64(st.Prev)*(1-elapsed) + float64(st.Curr)
+
+	res := RateLimitResult{Limit: l.Limit}
+	if count+1 <= float64(l.Limit) {
+		st.Curr++
+		count++
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.windowRetry(st, elapsed)
+	}
+	res.Remaining = max(0, l.Limit-int(math.Ceil(count)))
+	res.Reset = time.Duration(window - (now.UnixNano() - start))
+	if st.Curr > 0 {
+		// The current count weighs on the next window too.
+		res.Reset += l.Window
+	}
+	return res
+}
+
+// windowRetry returns how long until the weighted count leaves room for one
+// more request.
+func (l RateLimit) windowRetry(st *rateState, elapsed float64) time.Duration {
+	room := float64(l.Limit - 1)
+	window := float64(l.Window)
+	if st.Prev > 0 && float64(st.Curr) <= room {
+		// Within the current window, once the previous one weighs less.
+		at := 1 - (room-float64(st.Curr))/float64(st.Prev)
+		return time.Duration(math.Ceil((at - elapsed) * window))
+	}
+	// In the next window, where the current count becomes the previous one.
+	at := math.Max(0, 1-room/float64(st.Curr))
+	return time.Duration(math.Ceil((1 - elapsed + at) * window))
+}
+
+// KeyFunc returns the key a request is counted under. Requests for which it
+// returns "" are not limited.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP counts requests per client IP (see RealIP).
+func KeyByIP(r *http.Request) string {
+	return "ip:" + ClientIP(r)
+}
+
+// KeyByRoute counts requests per method and route pattern, all clients
+// together.
+func KeyByRoute(r *http.Request) string {
+	return "route:" + r.Method + " " + RoutePattern(r)
+}
+
+// KeyByUser counts requests per user ID, falling back to the client IP for
+// anonymous requests.
+func KeyByUser(userID func(r *http.Request) string) KeyFunc {
+	return func(r *http.Request) string {
+		if id := userID(r); id != "" {
+			return "user:" + id
+		}
+		return KeyByIP(r)
+	}
+}
+
+// KeyByAPIKey counts requests per API key read from header, falling back to
+// the client IP. Keys are hashed so they are never stored in clear.
+func KeyByAPIKey(header string) KeyFunc {
+	return func(r *http.Request) string {
+		key := r.Header.Get(header)
+		if key == "" {
+			return KeyByIP(r)
+		}
+		sum := sha256.Sum256([]byte(key))
+		return "apikey:" + hex.EncodeToString(sum[:16])
+	}
+}
+
+// Keys combines key functions, e.g. Keys(KeyByRoute, KeyByIP) for a limit per
+// client and route.
+func Keys(fns ...KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		parts := make([]string, 0, len(fns))
+		for _, fn := range fns {
+			k := fn(r)
+			if k == "" {
+				return ""
+			}
+			parts = append(parts, k)
+		}
+		return strings.Join(parts, "|")
+	}
+}
+
+// RoutePattern returns the chi route pattern of r ("/users/{id}"), resolving
+// it from the router when the middleware runs before routing, or the path
+// when no route matches.
+func RoutePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return r.URL.Path
+	}
+	if pattern := rctx.RoutePattern(); pattern != "" && !strings.HasSuffix(pattern, "/*") {
+		return pattern
+	}
+	if rctx.Routes != nil {
+		if pattern := rctx.Routes.Find(chi.NewRouteContext(), r.Method, r.URL.Path); pattern != "" {
+			return pattern
+		}
+	}
+	return r.URL.Path
+}
+
+// RateLimitOptions configures RateLimit.
+type RateLimitOptions struct {
+	// Limit applies to routes without a policy in Routes.
+	Limit RateLimit
+	// Routes are per-route policies keyed by "METHOD /pattern" or "/pattern"
+	// (any method), e.g. "POST /login". Each route gets its own counters.
+	Routes map[string]RateLimit
+	// Key defaults to KeyByIP.
+	Key KeyFunc
+	// Store defaults to a MemoryStore; use a CacheStore to share limits
+	// across instances.
+	Store RateLimitStore
+	// Prefix namespaces the store keys, defaults to "ratelimit:".
+	Prefix string
+	// Clock defaults to the system clock.
+	Clock Clock
+}
+
+// RateLimit limits requests with the given options. Responses carry the
+// RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy
+// headers; denied requests get a 429 with Retry-After. Store errors are
+// logged and let requests through.
+func (m *Middleware) RateLimit(opts RateLimitOptions) func(http.Handler) http.Handler {
+	if opts.Key == nil {
+		opts.Key = KeyByIP
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "ratelimit:"
+	}
+	if opts.Clock == nil {
+		opts.Clock = systemClock{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit, route, ok := opts.policy(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := opts.Key(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key = opts.Prefix + route + key
+
+			res, err := opts.Store.Take(r.Context(), key, limit, opts.Clock.Now())
+			if err != nil {
+				m.logger().ErrorContext(r.Context(), "rate limit", "method", r.Method, "path", r.URL.Path, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+			h.Set("RateLimit-Policy", limit.policy())
+
+			if !res.Allowed {
+				m.errors().TooManyRequestsResponse(w, r, strconv.Itoa(max(1, seconds(res.RetryAfter))))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// policy returns the limit of r and the key prefix of its route policy.
+func (o *RateLimitOptions) policy(r *http.Request) (RateLimit, string, bool) {
+	if len(o.Routes) > 0 {
+		pattern := RoutePattern(r)
+		for _, name := range []string{r.Method + " " + pattern, pattern} {
+			if l, ok := o.Routes[name]; ok {
+				return l, name + ":", l.Limit > 0 && l.Window > 0
+			}
+		}
+	}
+	return o.Limit, "", o.Limit.Limit > 0 && o.Limit.Window > 0
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// RateLimitStore keeps the counters of the rate limiter. Take must apply
+// limit.take atomically for a key; custom stores can count natively (e.g.
+// with a Redis script) as long as they return the same results.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateLimitResult, error)
+}
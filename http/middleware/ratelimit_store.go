@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the rate limiter, so tests can drive it with a
+// FakeClock.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// FakeClock is a Clock that only moves when told to.
+type FakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewFakeClock returns a clock stopped at t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{t: t}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+// MemoryStore keeps rate limit counters in memory, for a single instance.
+// Idle keys are swept as new requests come in.
+type MemoryStore struct {
+	mu        sync.Mutex
+	states    map[string]*memoryState
+	lastSweep time.Time
+}
+
+type memoryState struct {
+	rateState
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: make(map[string]*memoryState)}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+	st, ok := s.states[key]
+	if !ok || now.After(st.expires) {
+		st = &memoryState{}
+		s.states[key] = st
+	}
+	res := limit.take(&st.rateState, now)
+	st.expires = now.Add(stateTTL(limit))
+	return res, nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, st := range s.states {
+		if now.After(st.expires) {
+			delete(s.states, key)
+		}
+	}
+}
+
+// stateTTL is how long a state matters: two windows for the sliding window,
+// the time to refill an empty bucket for the token bucket.
+func stateTTL(limit RateLimit) time.Duration {
+	if limit.Algorithm == SlidingWindow {
+		return 2 * limit.Window
+	}
+	return time.Duration(float64(limit.Window) * float64(limit.burst()) / float64(limit.Limit))
+}
+
+// Cache is the part of the socle cache (Redis, Badger) used by CacheStore;
+// expires is in seconds.
+type Cache interface {
+	Has(key string) (bool, error)
+	Get(key string) (interface{}, error)
+	Set(key string, value interface{}, expires ...int) error
+}
+
+// keyLocks serializes the updates of a key without serializing the other
+// keys behind its cache round trips; keys share one of its mutexes by hash.
+type keyLocks [64]sync.Mutex
+
+func (l *keyLocks) of(key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &l[h.Sum32()%uint32(len(l))]
+}
+
+// cacheGetJSON decodes the JSON value of key, stored as a string by
+// cacheSetJSON.
+func cacheGetJSON(c Cache, key string, dst any) error {
+	v, err := c.Get(key)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	switch v := v.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cache value %s: unexpected %T", key, v)
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("cache value %s: %w", key, err)
+	}
+	return nil
+}
+
+func cacheSetJSON(c Cache, key string, v any, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Set(key, string(data), max(1, seconds(ttl)))
+}
+
+// CacheStore keeps rate limit counters in the socle cache, so every instance
+// shares them. The cache has no atomic update: a counter is read then
+// written back, serialized per key and instance only, so under concurrent
+// load N instances may together let up to N times the limit through. Use it
+// where an approximate limit is acceptable.
+type CacheStore struct {
+	Cache Cache
+	locks keyLocks
+}
+
+func NewCacheStore(cache Cache) *CacheStore {
+	return &CacheStore{Cache: cache}
+}
+
+func (s *CacheStore) Take(_ context.Context, key string, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	mu := s.locks.of(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	var st rateState
+	ok, err := s.Cache.Has(key)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if ok {
+		if err := cacheGetJSON(s.Cache, key, &st); err != nil {
+			return RateLimitResult{}, err
+		}
+	}
+
+	res := limit.take(&st, now)
+	if err := cacheSetJSON(s.Cache, key, &st, stateTTL(limit)); err != nil {
+		return RateLimitResult{}, err
+	}
+	return res, nil
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIP replaces r.RemoteAddr with the client IP when the request comes
+// from one of the trusted proxies (IPs or CIDRs). X-Forwarded-For is read
+// from right to left, skipping trusted hops; X-Real-IP is used when it is
+// absent. Headers of untrusted peers are ignored, so clients can't spoof
+// their address. It panics on an invalid proxy address.
+func (m *Middleware) RealIP(trustedProxies ...string) func(http.Handler) http.Handler {
+	trusted := make([]*net.IPNet, 0, len(trustedProxies))
+	for _, p := range trustedProxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				panic(fmt.Sprintf("middleware: invalid trusted proxy %q", p))
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(p)
+		if err != nil {
+			panic(fmt.Sprintf("middleware: invalid trusted proxy %q", p))
+		}
+		trusted = append(trusted, network)
+	}
+
+	isTrusted := func(ip net.IP) bool {
+		for _, network := range trusted {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer := net.ParseIP(ClientIP(r))
+			if peer == nil || !isTrusted(peer) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			client := ""
+			if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+				hops := strings.Split(strings.Join(xff, ","), ",")
+				for i := len(hops) - 1; i >= 0; i-- {
+					ip := net.ParseIP(strings.TrimSpace(hops[i]))
+					if ip == nil {
+						break
+					}
+					client = ip.String()
+					if !isTrusted(ip) {
+						break
+					}
+				}
+			} else if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+				client = ip.String()
+			}
+
+			if client != "" {
+				r.RemoteAddr = client
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the IP of r.RemoteAddr, without the port.
+func ClientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
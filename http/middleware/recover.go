@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/socle-lab/pkg/apperr"
+)
+
+// Recover turns panics into 500 responses written by the handler error
+// writer, which logs them with their stack. http.ErrAbortHandler is
+// re-panicked, as net/http expects.
+func (m *Middleware) Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := wrap(w)
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			err, ok := rec.(error)
+			if !ok {
+				err = fmt.Errorf("%v", rec)
+			}
+			err = apperr.Wrap(err, "panic")
+
+			if rw.wroteHeader {
+				// Too late for an error response: log and drop the connection.
+				m.logger().ErrorContext(r.Context(), "panic after the response started",
+					"method", r.Method, "path", r.URL.Path, "error", err, "stack", apperr.StackTrace(err))
+				panic(http.ErrAbortHandler)
+			}
+			m.errors().Error(rw, r, err)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
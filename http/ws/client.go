@@ -0,0 +1,96 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// Client is a Go client of a Hub, for tests and Go services.
+type Client struct {
+	ws      *websocket.Conn
+	mu      sync.Mutex
+	pending []Message
+}
+
+// Dial connects to a hub. url may use the http(s) or ws(s) scheme; header
+// carries the credentials (cookies, Authorization).
+func Dial(ctx context.Context, url string, header http.Header) (*Client, error) {
+	if rest, ok := strings.CutPrefix(url, "http"); ok {
+		url = "ws" + rest
+	}
+	c, _, err := websocket.Dial(ctx, url, &websocket.DialOptions{HTTPHeader: header})
+	if err != nil {
+		return nil, err
+	}
+	return &Client{ws: c}, nil
+}
+
+// Send writes a message to the hub.
+func (c *Client) Send(ctx context.Context, msg Message) error {
+	return wsjson.Write(ctx, c.ws, &msg)
+}
+
+// Subscribe subscribes to topic and waits for the hub's answer. Messages
+// received meanwhile are kept for Receive.
+func (c *Client) Subscribe(ctx context.Context, topic string) error {
+	return c.action(ctx, ActionSubscribe, EventSubscribed, topic)
+}
+
+// Unsubscribe unsubscribes from topic and waits for the hub's answer.
+func (c *Client) Unsubscribe(ctx context.Context, topic string) error {
+	return c.action(ctx, ActionUnsubscribe, EventUnsubscribed, topic)
+}
+
+func (c *Client) action(ctx context.Context, action, ack, topic string) error {
+	if err := c.Send(ctx, Message{Action: action, Topic: topic}); err != nil {
+		return err
+	}
+	for {
+		var msg Message
+		if err := wsjson.Read(ctx, c.ws, &msg); err != nil {
+			return err
+		}
+		if msg.Topic == topic && msg.Event == ack {
+			return nil
+		}
+		if msg.Topic == topic && msg.Event == EventError {
+			return fmt.Errorf("ws: %s %s: %s", action, topic, msg.Data)
+		}
+		c.mu.Lock()
+		c.pending = append(c.pending, msg)
+		c.mu.Unlock()
+	}
+}
+
+// Receive returns the next message from the hub.
+func (c *Client) Receive(ctx context.Context) (Message, error) {
+	c.mu.Lock()
+	if len(c.pending) > 0 {
+		msg := c.pending[0]
+		c.pending = c.pending[1:]
+		c.mu.Unlock()
+		return msg, nil
+	}
+	c.mu.Unlock()
+
+	var msg Message
+	err := wsjson.Read(ctx, c.ws, &msg)
+	return msg, err
+}
+
+// Decode unmarshals the data of msg into dst.
+func (msg Message) Decode(dst any) error {
+	return json.Unmarshal(msg.Data, dst)
+}
+
+// Close closes the connection normally.
+func (c *Client) Close() error {
+	return c.ws.Close(websocket.StatusNormalClosure, "")
+}
@@ -0,0 +1,430 @@
+// Package ws pushes real-time updates to browsers over WebSocket: a Hub
+// tracks connections and their topic subscriptions ("grid:users",
+// "record:users:42") and broadcasts messages to the subscribers of a topic.
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/socle-lab/pkg/auth"
+)
+
+// Actions clients send in Message.Action.
+const (
+	ActionSubscribe   = "subscribe"
+	ActionUnsubscribe = "unsubscribe"
+)
+
+// Events the hub sends back to clients.
+const (
+	EventSubscribed   = "subscribed"
+	EventUnsubscribed = "unsubscribed"
+	EventError        = "error"
+)
+
+// Message is the JSON frame exchanged with clients. Clients set Action to
+// subscribe to or unsubscribe from Topic; other messages go to
+// Hub.OnMessage. The hub sends Topic, Event and Data.
+type Message struct {
+	Action string          `json:"action,omitempty"`
+	Topic  string          `json:"topic,omitempty"`
+	Event  string          `json:"event,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// GridTopic is the topic of the updates of a grid.
+func GridTopic(grid string) string {
+	return "grid:" + grid
+}
+
+// RecordTopic is the topic of the updates of one record.
+func RecordTopic(resource string, id any) string {
+	b, _ := json.Marshal(id)
+	return "record:" + resource + ":" + string(trimQuotes(b))
+}
+
+func trimQuotes(b []byte) []byte {
+	if len(b) >= 2 && b[0] == '"' && b[len(b)-1] == '"' {
+		return b[1 : len(b)-1]
+	}
+	return b
+}
+
+var ErrHubClosed = errors.New("ws: hub closed")
+
+// Hub manages the connections and topic subscriptions. Its zero value is not
+// usable; create hubs with NewHub and set the options before serving.
+type Hub struct {
+	// Authorize decides whether the principal (nil for anonymous
+	// connections) may subscribe to topic; all subscriptions are allowed
+	// without it.
+	Authorize func(ctx context.Context, p *auth.Principal, topic string) bool
+	// OnMessage receives the messages of clients that are not subscription
+	// actions.
+	OnMessage func(c *Conn, msg Message)
+	// SendBuffer is the number of messages queued per connection (default
+	// 64). Publishing never blocks: connections whose buffer is full are
+	// too slow and get closed, to resync when they reconnect.
+	SendBuffer int
+	// PingInterval is the keepalive period (default 30s); connections not
+	// answering a ping within WriteTimeout are closed.
+	PingInterval time.Duration
+	// WriteTimeout bounds each write (default 10s).
+	WriteTimeout time.Duration
+	// MaxMessageBytes bounds client messages (default 32kb).
+	MaxMessageBytes int64
+	// MaxSubscriptions bounds the topics of a connection (default 100), so
+	// clients can't subscribe to any number of topics, Authorize or not.
+	MaxSubscriptions int
+	// OriginPatterns are the hosts allowed to connect besides the request's
+	// own host (see websocket.AcceptOptions).
+	OriginPatterns []string
+
+	mu     sync.RWMutex
+	conns  map[*Conn]struct{}
+	topics map[string]map[*Conn]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		conns:  make(map[*Conn]struct{}),
+		topics: make(map[string]map[*Conn]struct{}),
+	}
+}
+
+func (h *Hub) sendBuffer() int {
+	if h.SendBuffer > 0 {
+		return h.SendBuffer
+	}
+	return 64
+}
+
+func (h *Hub) maxSubscriptions() int {
+	if h.MaxSubscriptions > 0 {
+		return h.MaxSubscriptions
+	}
+	return 100
+}
+
+func (h *Hub) pingInterval() time.Duration {
+	if h.PingInterval > 0 {
+		return h.PingInterval
+	}
+	return 30 * time.Second
+}
+
+func (h *Hub) writeTimeout() time.Duration {
+	if h.WriteTimeout > 0 {
+		return h.WriteTimeout
+	}
+	return 10 * time.Second
+}
+
+// Serve upgrades the request and serves the connection until it closes.
+// The principal of the request context (see the auth middleware) is kept on
+// the connection; refuse anonymous requests before calling Serve when they
+// must not connect.
+func (h *Hub) Serve(w http.ResponseWriter, r *http.Request) error {
+	h.mu.RLock()
+	closed := h.closed
+	h.mu.RUnlock()
+	if closed {
+		return ErrHubClosed
+	}
+
+	wsc, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: h.OriginPatterns})
+	if err != nil {
+		return err
+	}
+	limit := h.MaxMessageBytes
+	if limit == 0 {
+		limit = 32 << 10
+	}
+	wsc.SetReadLimit(limit)
+
+	// The request context ends with the handler; the connection gets its own.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	c := &Conn{
+		hub:       h,
+		ws:        wsc,
+		principal: auth.FromContext(r.Context()),
+		send:      make(chan []byte, h.sendBuffer()),
+		topics:    make(map[string]struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		cancel()
+		wsc.Close(websocket.StatusGoingAway, "server shutting down")
+		return ErrHubClosed
+	}
+	h.conns[c] = struct{}{}
+	h.mu.Unlock()
+
+	defer h.remove(c)
+	go c.writeLoop()
+	return c.readLoop()
+}
+
+func (h *Hub) remove(c *Conn) {
+	h.mu.Lock()
+	delete(h.conns, c)
+	for topic := range c.topics {
+		h.unsubscribeLocked(c, topic)
+	}
+	h.mu.Unlock()
+	c.cancel()
+}
+
+func (h *Hub) unsubscribeLocked(c *Conn, topic string) {
+	delete(c.topics, topic)
+	if subs := h.topics[topic]; subs != nil {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// Publish sends event and data (JSON encoded) to the subscribers of topic
+// and returns how many connections it was queued for.
+func (h *Hub) Publish(topic, event string, data any) (int, error) {
+	frame, err := encode(topic, event, data)
+	if err != nil {
+		return 0, err
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
+	for c := range h.topics[topic] {
+		if c.enqueue(frame) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Broadcast sends event and data to every connection.
+func (h *Hub) Broadcast(event string, data any) (int, error) {
+	frame, err := encode("", event, data)
+	if err != nil {
+		return 0, err
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
+	for c := range h.conns {
+		if c.enqueue(frame) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Subscribers returns the number of connections subscribed to topic.
+func (h *Hub) Subscribers(topic string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics[topic])
+}
+
+// Connections returns the number of open connections.
+func (h *Hub) Connections() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.conns)
+}
+
+// Close closes every connection and refuses new ones.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	conns := make([]*Conn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range conns {
+		c.close(websocket.StatusGoingAway, "server shutting down")
+	}
+}
+
+func encode(topic, event string, data any) ([]byte, error) {
+	msg := Message{Topic: topic, Event: event}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		msg.Data = raw
+	}
+	return json.Marshal(&msg)
+}
+
+// Conn is a client connection of a Hub.
+type Conn struct {
+	hub       *Hub
+	ws        *websocket.Conn
+	principal *auth.Principal
+	send      chan []byte
+	topics    map[string]struct{} // guarded by hub.mu
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	closing   atomic.Bool // the server closes the connection
+}
+
+// Principal returns the principal of the upgraded request, or nil.
+func (c *Conn) Principal() *auth.Principal {
+	return c.principal
+}
+
+// Context is canceled when the connection closes.
+func (c *Conn) Context() context.Context {
+	return c.ctx
+}
+
+// Subscribe adds the connection to topic, if Hub.Authorize allows it and the
+// connection has less than Hub.MaxSubscriptions topics.
+func (c *Conn) Subscribe(topic string) bool {
+	if topic == "" {
+		return false
+	}
+	if c.hub.Authorize != nil && !c.hub.Authorize(c.ctx, c.principal, topic) {
+		return false
+	}
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	if _, ok := c.topics[topic]; !ok && len(c.topics) >= c.hub.maxSubscriptions() {
+		return false
+	}
+	c.topics[topic] = struct{}{}
+	if c.hub.topics[topic] == nil {
+		c.hub.topics[topic] = make(map[*Conn]struct{})
+	}
+	c.hub.topics[topic][c] = struct{}{}
+	return true
+}
+
+// Unsubscribe removes the connection from topic.
+func (c *Conn) Unsubscribe(topic string) {
+	c.hub.mu.Lock()
+	c.hub.unsubscribeLocked(c, topic)
+	c.hub.mu.Unlock()
+}
+
+// Send queues a message for this connection only.
+func (c *Conn) Send(topic, event string, data any) error {
+	frame, err := encode(topic, event, data)
+	if err != nil {
+		return err
+	}
+	if !c.enqueue(frame) {
+		return errors.New("ws: connection closed or too slow")
+	}
+	return nil
+}
+
+// Close closes the connection normally.
+func (c *Conn) Close() {
+	c.close(websocket.StatusNormalClosure, "")
+}
+
+// enqueue queues frame without blocking, closing the connection when its
+// buffer is full.
+func (c *Conn) enqueue(frame []byte) bool {
+	if c.ctx.Err() != nil {
+		return false
+	}
+	select {
+	case c.send <- frame:
+		return true
+	default:
+		go c.close(websocket.StatusPolicyViolation, "too slow")
+		return false
+	}
+}
+
+func (c *Conn) close(code websocket.StatusCode, reason string) {
+	// Close first: canceling aborts the pending read and writes, and the
+	// close frame with them.
+	c.closeOnce.Do(func() {
+		c.closing.Store(true)
+		c.ws.Close(code, reason)
+		c.cancel()
+	})
+}
+
+func (c *Conn) readLoop() error {
+	defer c.close(websocket.StatusNormalClosure, "")
+	for {
+		var msg Message
+		if err := wsjson.Read(c.ctx, c.ws, &msg); err != nil {
+			status := websocket.CloseStatus(err)
+			if status == websocket.StatusNormalClosure || status == websocket.StatusGoingAway || c.closing.Load() || c.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		switch msg.Action {
+		case ActionSubscribe:
+			if c.Subscribe(msg.Topic) {
+				c.Send(msg.Topic, EventSubscribed, nil)
+			} else {
+				c.Send(msg.Topic, EventError, map[string]string{"error": "subscription refused"})
+			}
+		case ActionUnsubscribe:
+			c.Unsubscribe(msg.Topic)
+			c.Send(msg.Topic, EventUnsubscribed, nil)
+		default:
+			if c.hub.OnMessage != nil {
+				c.hub.OnMessage(c, msg)
+			}
+		}
+	}
+}
+
+func (c *Conn) writeLoop() {
+	ping := time.NewTicker(c.hub.pingInterval())
+	defer ping.Stop()
+	timeout := c.hub.writeTimeout()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case frame := <-c.send:
+			ctx, cancel := context.WithTimeout(c.ctx, timeout)
+			err := c.ws.Write(ctx, websocket.MessageText, frame)
+			cancel()
+			if err != nil {
+				c.close(websocket.StatusInternalError, "write failed")
+				return
+			}
+		case <-ping.C:
+			ctx, cancel := context.WithTimeout(c.ctx, timeout)
+			err := c.ws.Ping(ctx)
+			cancel()
+			if err != nil {
+				c.close(websocket.StatusPolicyViolation, "ping timeout")
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/socle-lab/pkg/auth"
+)
+
+// Attributes added from the context.
+const (
+	RequestIDKey = "request_id"
+	UserIDKey    = "user_id"
+	RouteKey     = "route"
+)
+
+type attrsKey struct{}
+
+// WithAttrs returns a context whose records get attrs, in addition to those
+// of ctx.
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	all := make([]slog.Attr, 0, len(prev)+len(attrs))
+	all = append(append(all, prev...), attrs...)
+	return context.WithValue(ctx, attrsKey{}, all)
+}
+
+// WithRequestID returns a context whose records get the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return WithAttrs(ctx, slog.String(RequestIDKey, id))
+}
+
+// ContextHandler adds to each record the attributes of its context: those
+// of WithAttrs, the ID of the auth.Principal and the chi route pattern.
+type ContextHandler struct {
+	slog.Handler
+}
+
+// NewContextHandler wraps h; New and FromStd already do.
+func NewContextHandler(h slog.Handler) *ContextHandler {
+	return &ContextHandler{Handler: h}
+}
+
+func (h *ContextHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if ctx != nil {
+		if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+			rec.AddAttrs(attrs...)
+		}
+		if p := auth.FromContext(ctx); p != nil && p.ID != "" {
+			rec.AddAttrs(slog.String(UserIDKey, p.ID))
+		}
+		if rctx := chi.RouteContext(ctx); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				rec.AddAttrs(slog.String(RouteKey, pattern))
+			}
+		}
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,158 @@
+// Package logging builds the log/slog loggers of an app: leveled, in text or
+// JSON, with the request ID, user and route of the request context added to
+// every record logged with a context, and sensitive values redacted.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Format is the output format of a logger.
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// Options configures New.
+type Options struct {
+	// Level is the minimum level logged (default info). A *slog.LevelVar
+	// changes it at runtime.
+	Level slog.Leveler
+	// Format is FormatText (default) or FormatJSON.
+	Format Format
+	// Output is where records are written (default os.Stderr).
+	Output io.Writer
+	// AddSource adds the file and line of the call.
+	AddSource bool
+	// SensitiveKeys are redacted (default DefaultSensitiveKeys); see Redact.
+	SensitiveKeys []string
+}
+
+// New returns a logger configured by opts.
+func New(opts Options) *slog.Logger {
+	out := opts.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	ho := &slog.HandlerOptions{
+		Level:       opts.Level,
+		AddSource:   opts.AddSource,
+		ReplaceAttr: Redact(opts.SensitiveKeys, nil),
+	}
+
+	var h slog.Handler
+	if opts.Format == FormatJSON {
+		h = slog.NewJSONHandler(out, ho)
+	} else {
+		h = slog.NewTextHandler(out, ho)
+	}
+	return slog.New(NewContextHandler(h))
+}
+
+// FromStd adapts the info and error log.Loggers of core.Logger: records below
+// slog.LevelError go to info, the others to errorLog, in text without time
+// (the log.Logger adds its own). Only the Level and SensitiveKeys of opts are
+// used.
+func FromStd(info, errorLog *log.Logger, opts Options) *slog.Logger {
+	ho := &slog.HandlerOptions{
+		Level: opts.Level,
+		ReplaceAttr: Redact(opts.SensitiveKeys, func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		}),
+	}
+	return slog.New(NewContextHandler(&splitHandler{
+		low:  slog.NewTextHandler(stdWriter{info}, ho),
+		high: slog.NewTextHandler(stdWriter{errorLog}, ho),
+	}))
+}
+
+var stdLoggers sync.Map // [2]*log.Logger → *slog.Logger
+
+// Std returns FromStd(info, errorLog, Options{}), built once per pair of
+// loggers, for the defaults of the Slog helpers.
+func Std(info, errorLog *log.Logger) *slog.Logger {
+	key := [2]*log.Logger{info, errorLog}
+	if l, ok := stdLoggers.Load(key); ok {
+		return l.(*slog.Logger)
+	}
+	l, _ := stdLoggers.LoadOrStore(key, FromStd(info, errorLog, Options{}))
+	return l.(*slog.Logger)
+}
+
+// stdWriter writes each record as one entry of a log.Logger, keeping its
+// prefix and flags.
+type stdWriter struct {
+	l *log.Logger
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	w.l.Print(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// splitHandler sends errors to high and the rest to low.
+type splitHandler struct {
+	low, high slog.Handler
+}
+
+func (h *splitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if level >= slog.LevelError {
+		return h.high.Enabled(ctx, level)
+	}
+	return h.low.Enabled(ctx, level)
+}
+
+func (h *splitHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if rec.Level >= slog.LevelError {
+		return h.high.Handle(ctx, rec)
+	}
+	return h.low.Handle(ctx, rec)
+}
+
+func (h *splitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &splitHandler{low: h.low.WithAttrs(attrs), high: h.high.WithAttrs(attrs)}
+}
+
+func (h *splitHandler) WithGroup(name string) slog.Handler {
+	return &splitHandler{low: h.low.WithGroup(name), high: h.high.WithGroup(name)}
+}
+
+// ParseLevel parses "debug", "info", "warn" (or "warning"), "error" and
+// offsets such as "info+2".
+func ParseLevel(s string) (slog.Level, error) {
+	if strings.EqualFold(s, "warning") {
+		return slog.LevelWarn, nil
+	}
+	var l slog.Level
+	err := l.UnmarshalText([]byte(s))
+	return l, err
+}
+
+// Log logs args, formatted as by fmt.Println, at info for the "info" tag,
+// at error for "error" and at fallback for any other tag, as the Log(tag,
+// args...) helpers of handlers and applications always did.
+func Log(ctx context.Context, l *slog.Logger, tag string, fallback slog.Level, args ...any) {
+	level := fallback
+	switch tag {
+	case "info":
+		level = slog.LevelInfo
+	case "error":
+		level = slog.LevelError
+	}
+	if !l.Enabled(ctx, level) {
+		return
+	}
+	l.Log(ctx, level, strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// Redacted replaces the values of sensitive keys.
+const Redacted = "[REDACTED]"
+
+// DefaultSensitiveKeys are the key fragments redacted by default.
+var DefaultSensitiveKeys = []string{
+	"password", "passwd", "secret", "token", "authorization", "cookie",
+	"session", "apikey", "api_key", "private_key", "credential",
+}
+
+// Redact returns a slog.HandlerOptions.ReplaceAttr redacting the attributes
+// whose key, or the name of an enclosing group, contains one of keys
+// (case-insensitively; DefaultSensitiveKeys when empty), then calling next.
+func Redact(keys []string, next func(groups []string, a slog.Attr) slog.Attr) func(groups []string, a slog.Attr) slog.Attr {
+	if len(keys) == 0 {
+		keys = DefaultSensitiveKeys
+	}
+	lower := make([]string, len(keys))
+	for i, k := range keys {
+		lower[i] = strings.ToLower(k)
+	}
+	sensitive := func(key string) bool {
+		key = strings.ToLower(key)
+		for _, k := range lower {
+			if strings.Contains(key, k) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(groups []string, a slog.Attr) slog.Attr {
+		redact := sensitive(a.Key)
+		for _, g := range groups {
+			redact = redact || sensitive(g)
+		}
+		if redact {
+			a.Value = slog.StringValue(Redacted)
+		}
+		if next != nil {
+			return next(groups, a)
+		}
+		return a
+	}
+}
@@ -0,0 +1,214 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets suit durations in seconds, from 5ms to 10s.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// SizeBuckets suit sizes in bytes, from 100b to 100mb.
+var SizeBuckets = []float64{100, 1000, 10_000, 100_000, 1_000_000, 10_000_000, 100_000_000}
+
+// vec is a metric and its series, one per combination of label values.
+type vec struct {
+	name, help, typ string
+	labels          []string
+	buckets         []float64
+
+	mu     sync.RWMutex
+	series map[string]*series
+}
+
+func (v *vec) with(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s has labels %v, got %d values", v.name, v.labels, len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok := v.series[key]; ok {
+		return s
+	}
+	s = &series{values: slices.Clone(values)}
+	if v.typ == TypeHistogram {
+		s.counts = make([]uint64, len(v.buckets))
+	}
+	v.series[key] = s
+	return s
+}
+
+func (v *vec) Collect() []Family {
+	v.mu.RLock()
+	all := make([]*series, 0, len(v.series))
+	for _, s := range v.series {
+		all = append(all, s)
+	}
+	v.mu.RUnlock()
+	sort.Slice(all, func(i, j int) bool {
+		return slices.Compare(all[i].values, all[j].values) < 0
+	})
+
+	f := Family{Name: v.name, Help: v.help, Type: v.typ}
+	for _, s := range all {
+		labels := make([]Label, len(v.labels))
+		for i, name := range v.labels {
+			labels[i] = Label{name, s.values[i]}
+		}
+		if v.typ != TypeHistogram {
+			f.Samples = append(f.Samples, Sample{Labels: labels, Value: s.load()})
+			continue
+		}
+
+		s.mu.Lock()
+		counts, sum, count := slices.Clone(s.counts), s.sum, s.count
+		s.mu.Unlock()
+		var cumulative uint64
+		for i, le := range v.buckets {
+			cumulative += counts[i]
+			f.Samples = append(f.Samples, Sample{Suffix: "_bucket", Labels: withLabel(labels, "le", formatFloat(le)), Value: float64(cumulative)})
+		}
+		f.Samples = append(f.Samples,
+			Sample{Suffix: "_bucket", Labels: withLabel(labels, "le", "+Inf"), Value: float64(count)},
+			Sample{Suffix: "_sum", Labels: labels, Value: sum},
+			Sample{Suffix: "_count", Labels: labels, Value: float64(count)},
+		)
+	}
+	return []Family{f}
+}
+
+func withLabel(labels []Label, name, value string) []Label {
+	return append(slices.Clip(labels), Label{name, value})
+}
+
+// series holds a value (counters, gauges) or a distribution (histograms).
+type series struct {
+	values []string
+	bits   atomic.Uint64
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func (s *series) load() float64 {
+	return math.Float64frombits(s.bits.Load())
+}
+
+func (s *series) add(d float64) {
+	for {
+		old := s.bits.Load()
+		if s.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+d)) {
+			return
+		}
+	}
+}
+
+// Counter is a value that only goes up.
+type Counter struct{ s *series }
+
+func (c Counter) Inc() { c.s.add(1) }
+
+// Add adds v, which must not be negative.
+func (c Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.s.add(v)
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct{ v *vec }
+
+// Counter returns the counter name, registering it on first use.
+func (r *Registry) Counter(name, help string, labels ...string) CounterVec {
+	return CounterVec{r.register(name, help, TypeCounter, labels, nil)}
+}
+
+// With returns the counter of the label values, in the order of the labels.
+func (c CounterVec) With(values ...string) Counter { return Counter{c.v.with(values)} }
+
+// Gauge is a value that goes up and down.
+type Gauge struct{ s *series }
+
+func (g Gauge) Set(v float64) { g.s.bits.Store(math.Float64bits(v)) }
+func (g Gauge) Add(v float64) { g.s.add(v) }
+func (g Gauge) Inc()          { g.s.add(1) }
+func (g Gauge) Dec()          { g.s.add(-1) }
+
+// GaugeVec is a gauge partitioned by labels.
+type GaugeVec struct{ v *vec }
+
+// Gauge returns the gauge name, registering it on first use.
+func (r *Registry) Gauge(name, help string, labels ...string) GaugeVec {
+	return GaugeVec{r.register(name, help, TypeGauge, labels, nil)}
+}
+
+func (g GaugeVec) With(values ...string) Gauge { return Gauge{g.v.with(values)} }
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+func (h Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.s.mu.Lock()
+	if i < len(h.buckets) {
+		h.s.counts[i]++
+	}
+	h.s.sum += v
+	h.s.count++
+	h.s.mu.Unlock()
+}
+
+// ObserveSince observes the seconds elapsed since start.
+func (h Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct{ v *vec }
+
+// Histogram returns the histogram name, registering it on first use. Buckets
+// are the upper bounds, DefaultBuckets when nil.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	buckets = slices.Compact(buckets)
+	if n := len(buckets); n > 0 && math.IsInf(buckets[n-1], 1) {
+		buckets = buckets[:n-1]
+	}
+	return HistogramVec{r.register(name, help, TypeHistogram, labels, buckets)}
+}
+
+func (h HistogramVec) With(values ...string) Histogram {
+	return Histogram{h.v.with(values), h.v.buckets}
+}
+
+// GaugeFunc exports the value of fn, read at each scrape.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.Register(CollectorFunc(func() []Family {
+		return []Family{{Name: name, Help: help, Type: TypeGauge, Samples: []Sample{{Value: fn()}}}}
+	}))
+}
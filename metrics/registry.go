@@ -0,0 +1,210 @@
+// Package metrics collects counters, gauges and histograms in a Registry
+// and exposes them in the Prometheus text format. The http middleware, the
+// querybuilder runner and CSV imports record into it; apps register their
+// own metrics the same way.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types of a Family.
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+	TypeUntyped   = "untyped"
+)
+
+// ContentType is the media type of the text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Label is a label of a sample.
+type Label struct {
+	Name, Value string
+}
+
+// Sample is one line of a family: Suffix is appended to the family name
+// ("_bucket", "_sum", "_count" for histograms).
+type Sample struct {
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+// Family is a metric with its samples.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Collector produces families when the registry is scraped. Counters,
+// gauges and histograms are collectors; implement it to export values
+// computed on demand.
+type Collector interface {
+	Collect() []Family
+}
+
+// CollectorFunc adapts a function to Collector.
+type CollectorFunc func() []Family
+
+func (f CollectorFunc) Collect() []Family { return f() }
+
+// Registry holds the metrics of an app.
+type Registry struct {
+	mu         sync.RWMutex
+	metrics    map[string]*vec
+	collectors []Collector
+}
+
+// Default is the registry used when none is given. It exports the runtime
+// and process metrics.
+var Default = func() *Registry {
+	r := NewRegistry()
+	r.Register(RuntimeCollector())
+	return r
+}()
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]*vec)}
+}
+
+// Register adds a collector.
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mu.Unlock()
+}
+
+// register returns the metric registered under name, creating it. Getting
+// a metric again with the same type and labels returns the existing one;
+// anything else is a programming error and panics.
+func (r *Registry) register(name, help, typ string, labels []string, buckets []float64) *vec {
+	if !validName(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	for _, l := range labels {
+		if !validName(l) || strings.HasPrefix(l, "__") || l == "le" {
+			panic(fmt.Sprintf("metrics: invalid label name %q", l))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.metrics[name]; ok {
+		if v.typ != typ || !slices.Equal(v.labels, labels) || !slices.Equal(v.buckets, buckets) {
+			panic(fmt.Sprintf("metrics: %s already registered as a %s with labels %v", name, v.typ, v.labels))
+		}
+		return v
+	}
+	v := &vec{name: name, help: help, typ: typ, labels: labels, buckets: buckets, series: make(map[string]*series)}
+	r.metrics[name] = v
+	return v
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_' || c == ':' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Gather returns the families of the registry sorted by name.
+func (r *Registry) Gather() []Family {
+	r.mu.RLock()
+	families := make([]Family, 0, len(r.metrics))
+	for _, v := range r.metrics {
+		families = append(families, v.Collect()...)
+	}
+	collectors := slices.Clone(r.collectors)
+	r.mu.RUnlock()
+
+	for _, c := range collectors {
+		families = append(families, c.Collect()...)
+	}
+	slices.SortStableFunc(families, func(a, b Family) int { return strings.Compare(a.Name, b.Name) })
+	return families
+}
+
+// WriteText writes the families in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range r.Gather() {
+		if f.Help != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		}
+		typ := f.Type
+		if typ == "" {
+			typ = TypeUntyped
+		}
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.Name, typ)
+		for _, s := range f.Samples {
+			bw.WriteString(f.Name)
+			bw.WriteString(s.Suffix)
+			if len(s.Labels) > 0 {
+				bw.WriteByte('{')
+				for i, l := range s.Labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					bw.WriteString(l.Name)
+					bw.WriteString(`="`)
+					bw.WriteString(escapeLabel(l.Value))
+					bw.WriteByte('"')
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(formatFloat(s.Value))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry, for a /metrics route.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		w.Header().Set("Cache-Control", "no-store")
+		r.WriteText(w)
+	})
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
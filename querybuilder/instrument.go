@@ -0,0 +1,90 @@
+package querybuilder
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/socle-lab/pkg/metrics"
+)
+
+// InstrumentedDB times the queries run through it, e.g. by builders given
+// to RunWith:
+//
+//	db := querybuilder.Instrument(sqlDB, nil)
+//	rows, err := ApplyPagination(q, p).RunWith(db).QueryContext(ctx)
+//
+// Durations are recorded in db_query_duration_seconds{operation,status},
+// operation being the first keyword of the statement (select, insert...).
+type InstrumentedDB struct {
+	db       squirrel.StdSqlCtx
+	duration metrics.HistogramVec
+}
+
+// Instrument wraps db (a *sql.DB, *sql.Tx or *sql.Conn), recording in reg
+// (metrics.Default when nil).
+func Instrument(db squirrel.StdSqlCtx, reg *metrics.Registry) *InstrumentedDB {
+	if reg == nil {
+		reg = metrics.Default
+	}
+	return &InstrumentedDB{
+		db:       db,
+		duration: reg.Histogram("db_query_duration_seconds", "Duration of SQL queries.", nil, "operation", "status"),
+	}
+}
+
+func (db *InstrumentedDB) observe(query string, start time.Time, err error) {
+	status := "ok"
+	if err != nil && err != sql.ErrNoRows {
+		status = "error"
+	}
+	db.duration.With(operation(query), status).ObserveSince(start)
+}
+
+// operation returns the first keyword of query, lowercased.
+func operation(query string) string {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	if i := strings.IndexAny(query, " \t\r\n("); i >= 0 {
+		query = query[:i]
+	}
+	switch op := strings.ToLower(query); op {
+	case "select", "insert", "update", "delete", "with", "merge", "replace", "copy":
+		return op
+	}
+	return "other"
+}
+
+func (db *InstrumentedDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+func (db *InstrumentedDB) QueryRow(query string, args ...any) *sql.Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+func (db *InstrumentedDB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+func (db *InstrumentedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := db.db.QueryContext(ctx, query, args...)
+	db.observe(query, start, err)
+	return rows, err
+}
+
+func (db *InstrumentedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	start := time.Now()
+	row := db.db.QueryRowContext(ctx, query, args...)
+	db.observe(query, start, row.Err())
+	return row
+}
+
+func (db *InstrumentedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	res, err := db.db.ExecContext(ctx, query, args...)
+	db.observe(query, start, err)
+	return res, err
+}
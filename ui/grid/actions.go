@@ -22,6 +22,19 @@ const (
 	IntentCustom ActionIntent = "custom"
 )
 
+// DataFormat is a file format accepted by import actions or offered by
+// export actions (see the csv package).
+type DataFormat string
+
+const (
+	FormatCSV       DataFormat = "csv"
+	FormatXLSX      DataFormat = "xlsx"
+	FormatJSONLines DataFormat = "jsonl"
+)
+
+// DefaultDataFormats are used by import/export actions declaring none.
+var DefaultDataFormats = []DataFormat{FormatCSV, FormatXLSX, FormatJSONLines}
+
 // ActionConfirm remains intention-only.
 // Frontend decides how to render (modal, confirm(), toast, etc.)
 type ActionConfirm struct {
@@ -43,8 +56,13 @@ type GridAction struct {
 
 	Confirm *ActionConfirm `json:"confirm,omitempty" yaml:"confirm,omitempty"`
 
-	// Optional authorization hook (backend intention)
+	// Optional authorization hook (backend intention), see Grid.Authorized
 	Permission string `json:"permission,omitempty" yaml:"permission,omitempty"`
+	// Disabled: shown but not usable by the current principal
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+
+	// Import/export only: file formats the backend accepts or produces
+	Formats []DataFormat `json:"formats,omitempty" yaml:"formats,omitempty"`
 }
 
 func (a *GridAction) Kind() ElementKind { return KindAction }
@@ -61,6 +79,9 @@ func (a *GridAction) Normalize() {
 		// good default for “view/edit”
 		a.Method = "GET"
 	}
+	if (a.Intent == IntentImport || a.Intent == IntentExport) && len(a.Formats) == 0 {
+		a.Formats = append([]DataFormat(nil), DefaultDataFormats...)
+	}
 }
 
 func (a GridAction) Validate() error {
@@ -77,6 +98,13 @@ func (a GridAction) Validate() error {
 	default:
 		return errors.New("action: invalid intent: " + string(a.Intent))
 	}
+	for _, f := range a.Formats {
+		switch f {
+		case FormatCSV, FormatXLSX, FormatJSONLines:
+		default:
+			return errors.New("action: invalid format: " + string(f))
+		}
+	}
 	return nil
 }
 
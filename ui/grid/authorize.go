@@ -0,0 +1,49 @@
+package grid
+
+// DeniedMode tells Grid.Authorized what to do with elements the principal
+// may not use.
+type DeniedMode int
+
+const (
+	DeniedHide    DeniedMode = iota // remove them
+	DeniedDisable                   // keep them with Disabled set
+)
+
+// Authorized returns a copy of the grid for the current principal: actions
+// and navbar items whose Permission is refused by can are removed or
+// disabled, and actions are turned off when none is left. Elements without
+// Permission are kept as is. The grid itself is not modified, so it can be
+// shared between requests.
+func (g Grid) Authorized(can func(permission string) bool, mode DeniedMode) Grid {
+	allowed := func(permission string) bool {
+		return permission == "" || can(permission)
+	}
+
+	actions := make([]GridAction, 0, len(g.Actions.Items))
+	for _, a := range g.Actions.Items {
+		if !allowed(a.Permission) {
+			if mode == DeniedHide {
+				continue
+			}
+			a.Disabled = true
+		}
+		actions = append(actions, a)
+	}
+	g.Actions.Items = actions
+	if len(actions) == 0 {
+		g.Actions.Enabled = false
+	}
+
+	items := make([]GridNavbarItem, 0, len(g.Navbar.Items))
+	for _, it := range g.Navbar.Items {
+		if !allowed(it.Permission) {
+			if mode == DeniedHide {
+				continue
+			}
+			it.Disabled = true
+		}
+		items = append(items, it)
+	}
+	g.Navbar.Items = items
+	return g
+}
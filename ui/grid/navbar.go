@@ -10,6 +10,9 @@ type GridNavbar struct {
 type GridNavbarItem struct {
 	ElementBase `json:",inline" yaml:",inline"`
 	Path        string `json:"path" yaml:"path"`
+	// Optional authorization hook, see Grid.Authorized
+	Permission string `json:"permission,omitempty" yaml:"permission,omitempty"`
+	Disabled   bool   `json:"disabled,omitempty" yaml:"disabled,omitempty"`
 }
 
 func (n *GridNavbar) Normalize() {
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"strings"
 )
 
 type PasswordOptions struct {
@@ -148,3 +149,41 @@ func GenerateStrongPassword(opt PasswordOptions) (string, error) {
 
 	return string(out), nil
 }
+
+// CheckPassword reports whether pwd is at least opt.Length long and holds the
+// minimum number of characters of each class GenerateStrongPassword draws
+// from (lower and upper case letters, digits, symbols).
+func CheckPassword(pwd string, opt PasswordOptions) error {
+	if len([]rune(pwd)) < opt.Length {
+		return fmt.Errorf("password must be at least %d characters long", opt.Length)
+	}
+
+	var nLower, nUpper, nDigits, nSymbols int
+	for _, r := range pwd {
+		switch {
+		case strings.ContainsRune(lower, r):
+			nLower++
+		case strings.ContainsRune(upper, r):
+			nUpper++
+		case strings.ContainsRune(digits, r):
+			nDigits++
+		case strings.ContainsRune(symbols, r):
+			nSymbols++
+		}
+	}
+
+	for _, class := range []struct {
+		name     string
+		got, min int
+	}{
+		{"lower case letter", nLower, opt.MinLower},
+		{"upper case letter", nUpper, opt.MinUpper},
+		{"digit", nDigits, opt.MinDigits},
+		{"symbol", nSymbols, opt.MinSymbols},
+	} {
+		if class.got < class.min {
+			return fmt.Errorf("password must contain at least %d %s(s)", class.min, class.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package validator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrNoLookup is returned by Check when a unique or exists rule runs without
+// a Lookup.
+var ErrNoLookup = errors.New("validator: no lookup configured")
+
+// Query is an existence query: does Table hold a row whose Column equals
+// Value, ignoring the row whose ExcludeColumn equals ExcludeValue (the record
+// being updated)?
+type Query struct {
+	Table         string
+	Column        string
+	Value         any
+	ExcludeColumn string
+	ExcludeValue  any
+}
+
+// Lookup answers the queries of the unique and exists rules.
+type Lookup interface {
+	Exists(ctx context.Context, q Query) (bool, error)
+}
+
+// LookupFunc adapts a function into a Lookup.
+type LookupFunc func(ctx context.Context, q Query) (bool, error)
+
+func (f LookupFunc) Exists(ctx context.Context, q Query) (bool, error) { return f(ctx, q) }
+
+type lookupKey struct{}
+
+// WithLookup returns a context whose Lookup overrides the validator's one,
+// e.g. to query inside the request's transaction.
+func WithLookup(ctx context.Context, l Lookup) context.Context {
+	return context.WithValue(ctx, lookupKey{}, l)
+}
+
+// SetLookup sets the Lookup used by the unique and exists rules.
+func (v *Validator) SetLookup(l Lookup) {
+	v.lookup = l
+}
+
+// SetLookup sets the Lookup of Default.
+func SetLookup(l Lookup) {
+	Default.SetLookup(l)
+}
+
+type lookupErrors struct {
+	mu  sync.Mutex
+	err error
+}
+
+type lookupErrorsKey struct{}
+
+// Check validates s like StructCtx, running the unique and exists rules with
+// ctx; Struct and StructCtx skip them. Those rules query the database, so
+// they must be the last rules of their field: they only run once the static
+// rules of the field passed, and their errors are reported with the static
+// errors of the other fields.
+//
+// A malformed or misplaced unique or exists tag, a missing Lookup and a
+// failed lookup are returned as is rather than as validation errors.
+func (v *Validator) Check(ctx context.Context, s any) error {
+	if t := reflect.TypeOf(s); t != nil {
+		if err := checkLookupTags(t); err != nil {
+			return err
+		}
+	}
+
+	errs := &lookupErrors{}
+	err := v.StructCtx(context.WithValue(ctx, lookupErrorsKey{}, errs), s)
+	if errs.err != nil {
+		return errs.err
+	}
+	return err
+}
+
+// IsValidationError reports whether err holds validation errors, as opposed
+// to a failure of Check itself.
+func IsValidationError(err error) bool {
+	var errs validator.ValidationErrors
+	return errors.As(err, &errs)
+}
+
+// Check validates s with Default (see Validator.Check).
+func Check(ctx context.Context, s any) error {
+	return Default.Check(ctx, s)
+}
+
+func (v *Validator) registerLookupRules() {
+	rules := []struct {
+		tag      string
+		want     bool
+		messages map[string]string
+	}{
+		{"unique", false, map[string]string{
+			"en": "{0} is already taken",
+			"fr": "{0} est déjà utilisé",
+		}},
+		{"exists", true, map[string]string{
+			"en": "{0} refers to an unknown record",
+			"fr": "{0} fait référence à un enregistrement inconnu",
+		}},
+	}
+
+	for _, rule := range rules {
+		want := rule.want
+		fn := func(ctx context.Context, fl validator.FieldLevel) bool {
+			return v.lookupRule(ctx, fl, want)
+		}
+		if err := v.RegisterValidationCtx(rule.tag, fn); err != nil {
+			panic("validator: " + err.Error())
+		}
+		if err := v.RegisterMessages(rule.tag, rule.messages); err != nil {
+			panic("validator: " + err.Error())
+		}
+	}
+}
+
+// lookupRule implements unique=table.column (want false) and
+// exists=table.column (want true). An optional ":column=Field" excludes the
+// row whose column equals the sibling Field, as in
+// unique=users.email:id=ID. Zero values pass: combine with required. The
+// rule only runs under Check and passes otherwise.
+func (v *Validator) lookupRule(ctx context.Context, fl validator.FieldLevel, want bool) bool {
+	errs, _ := ctx.Value(lookupErrorsKey{}).(*lookupErrors)
+	if errs == nil {
+		return true
+	}
+	field := fl.Field()
+	if !field.IsValid() || field.IsZero() {
+		return true
+	}
+
+	q, excludeField, err := parseLookupParam(fl.Param())
+	if err == nil {
+		q.Value = field.Interface()
+		if excludeField != "" {
+			other, kind, _, found := fl.GetStructFieldOKAdvanced2(fl.Parent(), excludeField)
+			switch {
+			case !found:
+				err = fmt.Errorf("no field %s", excludeField)
+			case kind != reflect.Ptr && kind != reflect.Invalid && !other.IsZero():
+				q.ExcludeValue = other.Interface()
+			default:
+				q.ExcludeColumn = ""
+			}
+		}
+	}
+
+	var found bool
+	if err == nil {
+		lookup, _ := ctx.Value(lookupKey{}).(Lookup)
+		if lookup == nil {
+			lookup = v.lookup
+		}
+		if lookup == nil {
+			err = ErrNoLookup
+		} else {
+			found, err = lookup.Exists(ctx, q)
+		}
+	}
+
+	if err != nil {
+		errs.mu.Lock()
+		if errs.err == nil {
+			errs.err = fmt.Errorf("validator: %s on %s: %w", fl.GetTag(), fl.FieldName(), err)
+		}
+		errs.mu.Unlock()
+		return true
+	}
+	return found == want
+}
+
+var lookupTagsChecked sync.Map // reflect.Type → error
+
+// checkLookupTags validates the unique and exists tags of t and of the types
+// it nests, once per type, so a malformed or misplaced tag is reported
+// before any query runs.
+func checkLookupTags(t reflect.Type) error {
+	if v, ok := lookupTagsChecked.Load(t); ok {
+		if v == nil {
+			return nil
+		}
+		return v.(error)
+	}
+	err := walkLookupTags(t, "", map[reflect.Type]bool{})
+	lookupTagsChecked.Store(t, err)
+	return err
+}
+
+func walkLookupTags(t reflect.Type, path string, seen map[reflect.Type]bool) error {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := path + field.Name
+		lookup := ""
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			tag, param, _ := strings.Cut(rule, "=")
+			if strings.Contains(rule, "|") {
+				tag, _, _ = strings.Cut(rule, "|")
+				if strings.Contains(rule, "unique=") || strings.Contains(rule, "exists=") {
+					return fmt.Errorf("validator: field %s: unique and exists can't be alternatives", name)
+				}
+			}
+			if tag != "unique" && tag != "exists" {
+				if lookup != "" && tag != "" {
+					return fmt.Errorf("validator: field %s: %s must come after %s", name, lookup, tag)
+				}
+				continue
+			}
+			lookup = tag
+			_, excludeField, err := parseLookupParam(param)
+			if err == nil && excludeField != "" && !strings.Contains(excludeField, ".") {
+				if _, ok := t.FieldByName(excludeField); !ok {
+					err = fmt.Errorf("no field %s", excludeField)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("validator: field %s: %s: %w", name, tag, err)
+			}
+		}
+		if err := walkLookupTags(field.Type, name+".", seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+func parseLookupParam(param string) (Query, string, error) {
+	var q Query
+	target, exclude, _ := strings.Cut(param, ":")
+
+	i := strings.LastIndexByte(target, '.')
+	if i < 0 {
+		return q, "", fmt.Errorf("parameter %q must be table.column", param)
+	}
+	q.Table, q.Column = target[:i], target[i+1:]
+	if !identifier.MatchString(q.Table) || !identifier.MatchString(q.Column) {
+		return q, "", fmt.Errorf("invalid identifier in %q", param)
+	}
+
+	var excludeField string
+	if exclude != "" {
+		col, f, ok := strings.Cut(exclude, "=")
+		if !ok || !identifier.MatchString(col) || f == "" {
+			return q, "", fmt.Errorf("exclusion %q must be column=Field", exclude)
+		}
+		q.ExcludeColumn, excludeField = col, f
+	}
+	return q, excludeField, nil
+}
+
+// Querier is satisfied by *sql.DB, *sql.Tx and *sql.Conn.
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SQLLookup answers queries with SELECT 1 ... LIMIT 1 statements. Table and
+// column names come from validation tags and are checked to be plain
+// identifiers.
+type SQLLookup struct {
+	DB          Querier
+	Placeholder squirrel.PlaceholderFormat // default squirrel.Dollar
+}
+
+func NewSQLLookup(db Querier) *SQLLookup {
+	return &SQLLookup{DB: db, Placeholder: squirrel.Dollar}
+}
+
+func (l *SQLLookup) Exists(ctx context.Context, q Query) (bool, error) {
+	ph := l.Placeholder
+	if ph == nil {
+		ph = squirrel.Dollar
+	}
+
+	builder := squirrel.StatementBuilder.PlaceholderFormat(ph).
+		Select("1").
+		From(q.Table).
+		Where(squirrel.Eq{q.Column: q.Value}).
+		Limit(1)
+	if q.ExcludeColumn != "" {
+		builder = builder.Where(squirrel.NotEq{q.ExcludeColumn: q.ExcludeValue})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	var one int
+	err = l.DB.QueryRowContext(ctx, query, args...).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
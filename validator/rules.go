@@ -0,0 +1,317 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	"github.com/socle-lab/pkg/util"
+)
+
+// Rule is a reusable validation rule and its messages, keyed by locale. In
+// messages {0} is the field name and {1} the tag parameter.
+type Rule struct {
+	Tag string
+	// Func validates the field; exclusive with Alias.
+	Func validator.Func
+	// Alias names the existing tags the rule stands for.
+	Alias      string
+	CallIfNull bool
+	Messages   map[string]string
+}
+
+// Rules are registered on every instance created by New.
+var Rules = []Rule{
+	{
+		Tag:  "siren",
+		Func: isSIREN,
+		Messages: map[string]string{
+			"en": "{0} must be a valid SIREN number",
+			"fr": "{0} doit être un numéro SIREN valide",
+		},
+	},
+	{
+		Tag:  "siret",
+		Func: isSIRET,
+		Messages: map[string]string{
+			"en": "{0} must be a valid SIRET number",
+			"fr": "{0} doit être un numéro SIRET valide",
+		},
+	},
+	{
+		Tag:  "iban",
+		Func: isIBAN,
+		Messages: map[string]string{
+			"en": "{0} must be a valid IBAN",
+			"fr": "{0} doit être un IBAN valide",
+		},
+	},
+	{
+		Tag:  "phone",
+		Func: isPhone,
+		Messages: map[string]string{
+			"en": "{0} must be a phone number in international format (+33612345678)",
+			"fr": "{0} doit être un numéro de téléphone au format international (+33612345678)",
+		},
+	},
+	{
+		Tag:  "strongpassword",
+		Func: isStrongPassword,
+		Messages: map[string]string{
+			"en": "{0} must contain lower and upper case letters, digits and symbols",
+			"fr": "{0} doit contenir des minuscules, des majuscules, des chiffres et des symboles",
+		},
+	},
+	{
+		Tag:  "slug",
+		Func: isSlug,
+		Messages: map[string]string{
+			"en": "{0} may only contain lower case letters, digits and single dashes",
+			"fr": "{0} ne peut contenir que des minuscules, des chiffres et des tirets simples",
+		},
+	},
+	{
+		Tag:   "currency",
+		Alias: "iso4217",
+		Messages: map[string]string{
+			"en": "{0} must be an ISO 4217 currency code",
+			"fr": "{0} doit être un code de devise ISO 4217",
+		},
+	},
+	{
+		Tag:  "afterfield",
+		Func: CrossField(isAfter),
+		Messages: map[string]string{
+			"en": "{0} must be after {1}",
+			"fr": "{0} doit être postérieur à {1}",
+		},
+	},
+}
+
+// RegisterRule registers the rule and its messages on v.
+func (v *Validator) RegisterRule(rule Rule) error {
+	if rule.Alias != "" {
+		v.RegisterAlias(rule.Tag, rule.Alias)
+	} else if err := v.RegisterValidation(rule.Tag, rule.Func, rule.CallIfNull); err != nil {
+		return fmt.Errorf("registering %s: %w", rule.Tag, err)
+	}
+	return v.RegisterMessages(rule.Tag, rule.Messages)
+}
+
+// RegisterRule registers the rule on Default.
+func RegisterRule(rule Rule) error {
+	return Default.RegisterRule(rule)
+}
+
+// RegisterMessages sets the messages of tag, keyed by locale. It is also how
+// tags reported by struct level rules get their messages.
+func (v *Validator) RegisterMessages(tag string, messages map[string]string) error {
+	for locale, message := range messages {
+		trans, found := v.universal.GetTranslator(locale)
+		if !found {
+			return fmt.Errorf("registering %s: unsupported locale %s", tag, locale)
+		}
+		err := v.RegisterTranslation(tag, trans,
+			func(t ut.Translator) error {
+				return t.Add(tag, message, true)
+			},
+			func(t ut.Translator, fe validator.FieldError) string {
+				msg, err := t.T(tag, fe.Field(), fe.Param())
+				if err != nil {
+					return fe.Error()
+				}
+				return msg
+			})
+		if err != nil {
+			return fmt.Errorf("registering %s: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// RegisterStructRule registers a struct level rule for types; it reports
+// errors with sl.ReportError, whose tags get their messages from messages
+// (tag => locale => message). Like any rule it must be registered before the
+// types are first validated.
+func (v *Validator) RegisterStructRule(fn validator.StructLevelFunc, messages map[string]map[string]string, types ...any) error {
+	for tag, m := range messages {
+		if err := v.RegisterMessages(tag, m); err != nil {
+			return err
+		}
+	}
+	v.RegisterStructValidation(fn, types...)
+	return nil
+}
+
+// RegisterStructRule registers the struct level rule on Default.
+func RegisterStructRule(fn validator.StructLevelFunc, messages map[string]map[string]string, types ...any) error {
+	return Default.RegisterStructRule(fn, messages, types...)
+}
+
+// CrossField adapts a comparison between a field and the sibling field named
+// by the tag parameter (e.g. afterfield=StartDate) into a validator.Func.
+// Both values are dereferenced; the rule passes when either is nil.
+func CrossField(cmp func(field, other reflect.Value) bool) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		other, kind, _, found := fl.GetStructFieldOKAdvanced2(fl.Parent(), fl.Param())
+		if !found || kind == reflect.Invalid {
+			return false
+		}
+		field := fl.Field()
+		if !field.IsValid() || kind == reflect.Ptr && other.IsNil() {
+			return true
+		}
+		return cmp(field, other)
+	}
+}
+
+var (
+	numberSeps = regexp.MustCompile(`[\s.]`)
+	phoneSeps  = regexp.MustCompile(`[\s.()-]`)
+	e164Regexp = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	slugRegexp = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+)
+
+// luhn checks the Luhn checksum of a string of digits.
+func luhn(s string) bool {
+	sum := 0
+	for i := 0; i < len(s); i++ {
+		d := int(s[len(s)-1-i] - '0')
+		if d < 0 || d > 9 {
+			return false
+		}
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func digitsOnly(s string, n int) (string, bool) {
+	s = numberSeps.ReplaceAllString(s, "")
+	if len(s) != n {
+		return "", false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return "", false
+		}
+	}
+	return s, true
+}
+
+func isSIREN(fl validator.FieldLevel) bool {
+	s, ok := digitsOnly(fl.Field().String(), 9)
+	return ok && luhn(s)
+}
+
+func isSIRET(fl validator.FieldLevel) bool {
+	s, ok := digitsOnly(fl.Field().String(), 14)
+	if !ok {
+		return false
+	}
+	if strings.HasPrefix(s, "356000000") {
+		// La Poste: établissements hors Luhn, somme des chiffres multiple de 5
+		sum := 0
+		for _, c := range s {
+			sum += int(c - '0')
+		}
+		return sum%5 == 0
+	}
+	return luhn(s)
+}
+
+func isIBAN(fl validator.FieldLevel) bool {
+	s := strings.ToUpper(strings.ReplaceAll(fl.Field().String(), " ", ""))
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case i < 2 && (c < 'A' || c > 'Z'),
+			i >= 2 && i < 4 && (c < '0' || c > '9'),
+			(c < '0' || c > '9') && (c < 'A' || c > 'Z'):
+			return false
+		}
+	}
+
+	// ISO 13616: moved country code and check digits, mod 97 == 1
+	rearranged := s[4:] + s[:4]
+	mod := 0
+	for _, c := range rearranged {
+		if c >= 'A' {
+			n := int(c-'A') + 10
+			mod = (mod*100 + n) % 97
+		} else {
+			mod = (mod*10 + int(c-'0')) % 97
+		}
+	}
+	return mod == 1
+}
+
+// isPhone accepts E.164 numbers written with spaces, dots, dashes or
+// parentheses.
+func isPhone(fl validator.FieldLevel) bool {
+	return e164Regexp.MatchString(phoneSeps.ReplaceAllString(fl.Field().String(), ""))
+}
+
+// isStrongPassword requires one character of each class and 12 characters,
+// or the length given as parameter (strongpassword=16).
+func isStrongPassword(fl validator.FieldLevel) bool {
+	opt := util.PasswordOptions{Length: 12, MinLower: 1, MinUpper: 1, MinDigits: 1, MinSymbols: 1}
+	if p := fl.Param(); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			panic(fmt.Sprintf("validator: strongpassword: invalid length %q", p))
+		}
+		opt.Length = n
+	}
+	return util.CheckPassword(fl.Field().String(), opt) == nil
+}
+
+func isSlug(fl validator.FieldLevel) bool {
+	return slugRegexp.MatchString(fl.Field().String())
+}
+
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"}
+
+// isAfter compares times, or strings holding dates.
+func isAfter(field, other reflect.Value) bool {
+	a, ok := asTime(field)
+	if !ok {
+		return false
+	}
+	b, ok := asTime(other)
+	if !ok {
+		return false
+	}
+	return a.After(b)
+}
+
+func asTime(v reflect.Value) (time.Time, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return time.Time{}, false
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t, true
+	}
+	if v.Kind() == reflect.String {
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, v.String()); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,161 @@
+package validator
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	fr_translations "github.com/go-playground/validator/v10/translations/fr"
+)
+
+// DefaultLocale is used when none of the requested locales is supported.
+const DefaultLocale = "en"
+
+// Messages used for tags without a translation.
+var fallbackMessages = map[string]string{
+	"en": "{0} is invalid",
+	"fr": "{0} n'est pas valide",
+}
+
+func (v *Validator) registerTranslations() {
+	for locale, register := range map[string]func(*validator.Validate, ut.Translator) error{
+		"en": en_translations.RegisterDefaultTranslations,
+		"fr": fr_translations.RegisterDefaultTranslations,
+	} {
+		trans, _ := v.universal.GetTranslator(locale)
+		if err := register(v.Validate, trans); err != nil {
+			panic("validator: registering " + locale + " translations: " + err.Error())
+		}
+		if err := trans.Add("invalid", fallbackMessages[locale], false); err != nil {
+			panic("validator: registering " + locale + " translations: " + err.Error())
+		}
+	}
+}
+
+// Translator returns the translator of the first supported locale, given as
+// language tags ("fr", "fr-FR") or Accept-Language headers, falling back to
+// DefaultLocale.
+func (v *Validator) Translator(locales ...string) ut.Translator {
+	for _, locale := range locales {
+		for _, tag := range ParseAcceptLanguage(locale) {
+			base, _, _ := strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-")
+			if trans, found := v.universal.GetTranslator(strings.ToLower(base)); found {
+				return trans
+			}
+		}
+	}
+	trans, _ := v.universal.GetTranslator(DefaultLocale)
+	return trans
+}
+
+// Translator returns a translator of Default (see Validator.Translator).
+func Translator(locales ...string) ut.Translator {
+	return Default.Translator(locales...)
+}
+
+// ParseAcceptLanguage returns the language tags of an Accept-Language header
+// by decreasing quality; a bare tag is returned as is.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q <= 0 {
+				continue
+			}
+		}
+		tags = append(tags, weighted{tag, q})
+	}
+
+	// Stable insertion sort: headers are short.
+	for i := 1; i < len(tags); i++ {
+		for j := i; j > 0 && tags[j].q > tags[j-1].q; j-- {
+			tags[j], tags[j-1] = tags[j-1], tags[j]
+		}
+	}
+
+	out := make([]string, len(tags))
+	for i, t := range tags {
+		out[i] = t.tag
+	}
+	return out
+}
+
+// Message renders fe in the translator's locale. When target, the validated
+// struct, is given, a `label` tag on the field replaces its name.
+func Message(fe validator.FieldError, trans ut.Translator, target any) string {
+	field := fe.Field()
+	msg := fe.Translate(trans)
+	if msg == "" || msg == fe.Error() {
+		// No translation registered for the tag.
+		msg, _ = trans.T("invalid", field)
+		if fe.Param() != "" {
+			msg += " (" + fe.Tag() + "=" + fe.Param() + ")"
+		} else {
+			msg += " (" + fe.Tag() + ")"
+		}
+	}
+
+	if label := Label(target, fe.StructNamespace()); label != "" {
+		// Bundled messages start with the field name ({0}).
+		if rest, ok := strings.CutPrefix(msg, field); ok {
+			msg = label + rest
+		}
+	}
+	return msg
+}
+
+// Field returns the path of the field in error using json/form names, without
+// the root struct: "email", "address.city", "items[0].name".
+func Field(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if _, rest, ok := strings.Cut(ns, "."); ok {
+		return rest
+	}
+	return fe.Field()
+}
+
+// Label returns the `label` tag of the field at structNamespace (as reported
+// by FieldError.StructNamespace) in target, or "".
+func Label(target any, structNamespace string) string {
+	if target == nil {
+		return ""
+	}
+	t := reflect.TypeOf(target)
+
+	segments := strings.Split(structNamespace, ".")
+	if len(segments) < 2 {
+		return ""
+	}
+
+	var label string
+	for _, segment := range segments[1:] {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return ""
+		}
+		name, _, _ := strings.Cut(segment, "[")
+		f, ok := t.FieldByName(name)
+		if !ok {
+			return ""
+		}
+		label, t = f.Tag.Get("label"), f.Type
+	}
+	return label
+}
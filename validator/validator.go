@@ -1,9 +1,61 @@
 package validator
 
-import "github.com/go-playground/validator/v10"
+import (
+	"reflect"
+	"strings"
 
-var Validate *validator.Validate
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/fr"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+)
+
+// Validator is a validator instance with its own translations.
+type Validator struct {
+	*validator.Validate
+	universal *ut.UniversalTranslator
+	lookup    Lookup
+}
+
+// Default is the shared instance; Validate is its underlying validator.
+var (
+	Default  *Validator
+	Validate *validator.Validate
+)
 
 func init() {
-	Validate = validator.New(validator.WithRequiredStructEnabled())
+	Default = New()
+	Validate = Default.Validate
+}
+
+// New returns an isolated validator: json/form field names, the en and fr
+// messages, the unique/exists rules and the rules of Rules, but none of the rules or struct
+// validations registered on Default since. Tests use it to register rules
+// without leaking them.
+func New() *Validator {
+	v := &Validator{
+		Validate:  validator.New(validator.WithRequiredStructEnabled()),
+		universal: ut.New(en.New(), en.New(), fr.New()),
+	}
+	v.RegisterTagNameFunc(fieldName)
+	v.registerTranslations()
+	v.registerLookupRules()
+	for _, rule := range Rules {
+		if err := v.RegisterRule(rule); err != nil {
+			panic("validator: " + err.Error())
+		}
+	}
+	return v
+}
+
+// fieldName names fields in errors after their json tag, else their form
+// tag, else their Go name.
+func fieldName(f reflect.StructField) string {
+	for _, key := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(f.Tag.Get(key), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
 }